@@ -0,0 +1,145 @@
+package main
+
+import (
+	randv2 "math/rand/v2"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Metric orders of -metric-order, besides orderReverse and orderShuffle.
+const (
+	metricOrderSDK  = "sdk"
+	metricOrderName = "name"
+)
+
+// orderMetrics puts the metrics of every scope of rm in the -metric-order
+// order before they are split into chunks: sorted by name, reversed from
+// the order of the SDK, which is the order of the instruments in the
+// service, or shuffled with rng. metricOrderSDK keeps them as they are.
+func orderMetrics(rm *metricdata.ResourceMetrics, order string, rng *randv2.Rand) {
+	for _, sm := range rm.ScopeMetrics {
+		metrics := sm.Metrics
+		switch order {
+		case metricOrderName:
+			slices.SortStableFunc(metrics, func(a, b metricdata.Metrics) int { return strings.Compare(a.Name, b.Name) })
+		case orderReverse:
+			slices.Reverse(metrics)
+		case orderShuffle:
+			rng.Shuffle(len(metrics), func(i, j int) { metrics[i], metrics[j] = metrics[j], metrics[i] })
+		}
+	}
+}
+
+// dropMetrics removes the metrics named in names from every scope of rm,
+// in place.
+func dropMetrics(rm *metricdata.ResourceMetrics, names map[string]bool) {
+	for i := range rm.ScopeMetrics {
+		rm.ScopeMetrics[i].Metrics = slices.DeleteFunc(rm.ScopeMetrics[i].Metrics, func(m metricdata.Metrics) bool { return names[m.Name] })
+	}
+}
+
+// splitResourceMetrics splits rm into chunks of at most n data points each.
+// Every chunk keeps the resource of rm and the scopes of the metrics it
+// carries, and a metric whose data points do not fit into the remaining
+// room of a chunk is continued in the next one. It returns rm unchanged if
+// n is not positive or rm already fits.
+func splitResourceMetrics(rm *metricdata.ResourceMetrics, n int) []*metricdata.ResourceMetrics {
+	if n <= 0 || countDataPoints(rm) <= n {
+		return []*metricdata.ResourceMetrics{rm}
+	}
+	var chunks []*metricdata.ResourceMetrics
+	var chunk *metricdata.ResourceMetrics
+	room := 0
+	for _, sm := range rm.ScopeMetrics {
+		newScope := true
+		for _, m := range sm.Metrics {
+			total := metricDataPoints(m)
+			for lo := 0; lo < total; {
+				if room == 0 {
+					chunk = &metricdata.ResourceMetrics{Resource: rm.Resource}
+					chunks = append(chunks, chunk)
+					room = n
+					newScope = true
+				}
+				if newScope {
+					chunk.ScopeMetrics = append(chunk.ScopeMetrics, metricdata.ScopeMetrics{Scope: sm.Scope})
+					newScope = false
+				}
+				hi := min(total, lo+room)
+				scope := &chunk.ScopeMetrics[len(chunk.ScopeMetrics)-1]
+				scope.Metrics = append(scope.Metrics, sliceDataPoints(m, lo, hi))
+				room -= hi - lo
+				lo = hi
+			}
+		}
+	}
+	return chunks
+}
+
+// metricDataPoints returns the number of data points of m.
+func metricDataPoints(m metricdata.Metrics) int {
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[float64]:
+		return len(data.DataPoints)
+	case metricdata.Gauge[int64]:
+		return len(data.DataPoints)
+	case metricdata.Sum[float64]:
+		return len(data.DataPoints)
+	case metricdata.Sum[int64]:
+		return len(data.DataPoints)
+	case metricdata.Histogram[float64]:
+		return len(data.DataPoints)
+	case metricdata.Histogram[int64]:
+		return len(data.DataPoints)
+	}
+	return 0
+}
+
+// sliceDataPoints returns a copy of m with only the data points in [lo, hi).
+func sliceDataPoints(m metricdata.Metrics, lo, hi int) metricdata.Metrics {
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[float64]:
+		data.DataPoints = data.DataPoints[lo:hi]
+		m.Data = data
+	case metricdata.Gauge[int64]:
+		data.DataPoints = data.DataPoints[lo:hi]
+		m.Data = data
+	case metricdata.Sum[float64]:
+		data.DataPoints = data.DataPoints[lo:hi]
+		m.Data = data
+	case metricdata.Sum[int64]:
+		data.DataPoints = data.DataPoints[lo:hi]
+		m.Data = data
+	case metricdata.Histogram[float64]:
+		data.DataPoints = data.DataPoints[lo:hi]
+		m.Data = data
+	case metricdata.Histogram[int64]:
+		data.DataPoints = data.DataPoints[lo:hi]
+		m.Data = data
+	}
+	return m
+}
+
+// splitRequests splits rm into exactly n chunks, spreading its data points
+// evenly over as many as needed and filling up with chunks that carry only
+// the resource.
+func splitRequests(rm *metricdata.ResourceMetrics, n int) []*metricdata.ResourceMetrics {
+	points := countDataPoints(rm)
+	chunks := splitResourceMetrics(rm, (points+n-1)/n)
+	for len(chunks) < n {
+		chunks = append(chunks, &metricdata.ResourceMetrics{Resource: rm.Resource})
+	}
+	return chunks
+}
+
+// splitExport splits rm into the requests of an export, of at most
+// -max-points-per-request data points or as many as -requests-per-interval
+// gives the service.
+func (opts options) splitExport(rm *metricdata.ResourceMetrics) []*metricdata.ResourceMetrics {
+	if opts.requests > 0 {
+		return splitRequests(rm, opts.requests)
+	}
+	return splitResourceMetrics(rm, opts.maxPoints)
+}
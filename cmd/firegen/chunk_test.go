@@ -0,0 +1,116 @@
+package main
+
+import (
+	randv2 "math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestSplitResourceMetrics(t *testing.T) {
+	gauge := func(values ...float64) metricdata.Gauge[float64] {
+		var g metricdata.Gauge[float64]
+		for _, v := range values {
+			g.DataPoints = append(g.DataPoints, metricdata.DataPoint[float64]{Value: v})
+		}
+		return g
+	}
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.Empty(),
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{Scope: instrumentation.Scope{Name: "a"}, Metrics: []metricdata.Metrics{
+				{Name: "m0", Data: gauge(1, 2, 3)},
+				{Name: "m1", Data: gauge(4)},
+			}},
+			{Scope: instrumentation.Scope{Name: "b"}, Metrics: []metricdata.Metrics{
+				{Name: "m0", Data: gauge(5, 6)},
+			}},
+		},
+	}
+
+	assert.Equal(t, []*metricdata.ResourceMetrics{rm}, splitResourceMetrics(rm, 0))
+	assert.Equal(t, []*metricdata.ResourceMetrics{rm}, splitResourceMetrics(rm, 6))
+
+	chunks := splitResourceMetrics(rm, 2)
+	assert.Equal(t, []*metricdata.ResourceMetrics{
+		{Resource: rm.Resource, ScopeMetrics: []metricdata.ScopeMetrics{
+			{Scope: instrumentation.Scope{Name: "a"}, Metrics: []metricdata.Metrics{{Name: "m0", Data: gauge(1, 2)}}},
+		}},
+		{Resource: rm.Resource, ScopeMetrics: []metricdata.ScopeMetrics{
+			{Scope: instrumentation.Scope{Name: "a"}, Metrics: []metricdata.Metrics{{Name: "m0", Data: gauge(3)}, {Name: "m1", Data: gauge(4)}}},
+		}},
+		{Resource: rm.Resource, ScopeMetrics: []metricdata.ScopeMetrics{
+			{Scope: instrumentation.Scope{Name: "b"}, Metrics: []metricdata.Metrics{{Name: "m0", Data: gauge(5, 6)}}},
+		}},
+	}, chunks)
+}
+
+func TestSplitRequests(t *testing.T) {
+	gauge := metricdata.Gauge[float64]{DataPoints: make([]metricdata.DataPoint[float64], 5)}
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.Empty(),
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{Scope: instrumentation.Scope{Name: "a"}, Metrics: []metricdata.Metrics{{Name: "m0", Data: gauge}}},
+		},
+	}
+
+	for _, test := range []struct{ n, full int }{{1, 1}, {2, 2}, {5, 5}, {10, 5}} {
+		chunks := splitRequests(rm, test.n)
+		assert.Len(t, chunks, test.n)
+		total := 0
+		for i, chunk := range chunks {
+			assert.Same(t, rm.Resource, chunk.Resource)
+			assert.Equal(t, i < test.full, countDataPoints(chunk) > 0, "n=%d chunk %d", test.n, i)
+			total += countDataPoints(chunk)
+		}
+		assert.Equal(t, 5, total)
+	}
+
+	empty := &metricdata.ResourceMetrics{Resource: resource.Empty()}
+	assert.Len(t, splitRequests(empty, 3), 3)
+}
+
+func TestOrderMetrics(t *testing.T) {
+	names := func(rm *metricdata.ResourceMetrics) []string {
+		var names []string
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			names = append(names, m.Name)
+		}
+		return names
+	}
+	collect := func() *metricdata.ResourceMetrics {
+		return &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{
+			{Name: "b"}, {Name: "c"}, {Name: "a"}, {Name: "d"},
+		}}}}
+	}
+	rng := randv2.New(randv2.NewPCG(1, 0))
+
+	rm := collect()
+	orderMetrics(rm, metricOrderSDK, rng)
+	assert.Equal(t, []string{"b", "c", "a", "d"}, names(rm))
+	orderMetrics(rm, metricOrderName, rng)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names(rm))
+	rm = collect()
+	orderMetrics(rm, orderReverse, rng)
+	assert.Equal(t, []string{"d", "a", "c", "b"}, names(rm))
+
+	shuffled := collect()
+	orderMetrics(shuffled, orderShuffle, randv2.New(randv2.NewPCG(1, 0)))
+	again := collect()
+	orderMetrics(again, orderShuffle, randv2.New(randv2.NewPCG(1, 0)))
+	assert.Equal(t, names(shuffled), names(again))
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, names(shuffled))
+}
+
+func TestDropMetrics(t *testing.T) {
+	rm := &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{
+		{Metrics: []metricdata.Metrics{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+		{Metrics: []metricdata.Metrics{{Name: "b"}}},
+	}}
+	dropMetrics(rm, map[string]bool{"b": true})
+	assert.Equal(t, []metricdata.Metrics{{Name: "a"}, {Name: "c"}}, rm.ScopeMetrics[0].Metrics)
+	assert.Empty(t, rm.ScopeMetrics[1].Metrics)
+}
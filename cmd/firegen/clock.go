@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// virtualClock maps the wall clock to the event time that the data points
+// are timestamped with, for -clock-start and -clock-speed. All services
+// share one clock, so their data lines up in event time however fast the
+// clock runs. The zero virtualClock is the wall clock.
+type virtualClock struct {
+	// wall is the wall clock time at which the event time is start.
+	wall, start time.Time
+	speed       float64
+}
+
+// realTime reports whether the event time is the wall clock time, the
+// default.
+func (c virtualClock) realTime() bool {
+	return c.speed == 0 || c.speed == 1 && c.start.Equal(c.wall)
+}
+
+// at returns the event time at the wall clock time t.
+func (c virtualClock) at(t time.Time) time.Time {
+	if c.realTime() {
+		return t
+	}
+	return c.start.Add(time.Duration(float64(t.Sub(c.wall)) * c.speed))
+}
+
+// now returns the current event time.
+func (c virtualClock) now() time.Time {
+	return c.at(time.Now())
+}
+
+// catchUp returns how long after the wall clock time the clock was set at
+// the event time meets the wall clock time, and false if it never does. A
+// clock that starts in the past and runs faster than the wall clock catches
+// up with it, so a backfill continues into the future.
+func (c virtualClock) catchUp() (time.Duration, bool) {
+	if c.realTime() || c.speed == 1 {
+		return 0, false
+	}
+	d := time.Duration(float64(c.wall.Sub(c.start)) / (c.speed - 1))
+	return d, d > 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestVirtualClock(t *testing.T) {
+	wall := time.Unix(1_000_000, 0)
+	real := virtualClock{wall: wall, start: wall, speed: 1}
+	assert.True(t, real.realTime())
+	assert.Equal(t, wall.Add(time.Minute), real.at(wall.Add(time.Minute)))
+	_, ok := real.catchUp()
+	assert.False(t, ok)
+	assert.True(t, virtualClock{}.realTime())
+	assert.Equal(t, wall, virtualClock{}.at(wall))
+
+	backfill := virtualClock{wall: wall, start: wall.Add(-59 * time.Hour), speed: 60}
+	assert.False(t, backfill.realTime())
+	assert.Equal(t, wall.Add(-59*time.Hour), backfill.at(wall))
+	assert.Equal(t, wall.Add(-58*time.Hour), backfill.at(wall.Add(time.Minute)))
+	d, ok := backfill.catchUp()
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, d)
+	assert.Equal(t, wall.Add(d), backfill.at(wall.Add(d)))
+
+	_, ok = virtualClock{wall: wall, start: wall.Add(-time.Hour), speed: 0.5}.catchUp()
+	assert.False(t, ok)
+}
+
+func TestMapTimestampsVirtualClock(t *testing.T) {
+	wall := time.Unix(1_000_000, 0)
+	clock := virtualClock{wall: wall, start: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), speed: 10}
+	rm := &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{
+		{Name: "gauge", Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{{Time: wall.Add(time.Second)}}}},
+		{Name: "sum", Data: metricdata.Sum[int64]{DataPoints: []metricdata.DataPoint[int64]{{StartTime: wall, Time: wall.Add(2 * time.Second)}}}},
+	}}}}
+
+	mapTimestamps(rm, clock.at)
+	gauge := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]).DataPoints[0]
+	assert.True(t, gauge.StartTime.IsZero())
+	assert.Equal(t, clock.start.Add(10*time.Second), gauge.Time)
+	sum := rm.ScopeMetrics[0].Metrics[1].Data.(metricdata.Sum[int64]).DataPoints[0]
+	assert.Equal(t, clock.start, sum.StartTime)
+	assert.Equal(t, clock.start.Add(20*time.Second), sum.Time)
+}
@@ -0,0 +1,881 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type config struct {
+	Metrics    metricsConfig     `yaml:"metrics"`
+	Interval   int               `yaml:"interval"`
+	Services   int               `yaml:"services"`
+	Attributes []attributeConfig `yaml:"attributes"`
+	// ResourceAttributes are combined into a cross product like Attributes,
+	// and each service is assigned one combination for its resource.
+	ResourceAttributes []attributeConfig `yaml:"resourceAttributes"`
+	// Tenants split the services into groups exporting with their own
+	// credentials. Without tenants all services use the command line
+	// credentials.
+	Tenants []tenantConfig `yaml:"tenants"`
+	// Transports split the services into groups exporting over their own
+	// protocol and endpoint, each with a fraction of the services. Without
+	// transports all services use the command line protocol and endpoint.
+	Transports []transportConfig `yaml:"transports"`
+	// Scopes is the number of instrumentation scopes per service. The
+	// metrics are spread over the scopes, unless DuplicateScopeMetrics
+	// registers every metric in every scope, so the same metric name
+	// intentionally appears in several scopes of a service.
+	Scopes                int  `yaml:"scopes"`
+	DuplicateScopeMetrics bool `yaml:"duplicateScopeMetrics"`
+	// ScopeAttributes are attached to the instrumentation scopes of all
+	// services.
+	ScopeAttributes map[string]string `yaml:"scopeAttributes"`
+	// MaxSeries caps the total number of series -cardinality-growth grows
+	// to. Zero grows without limit.
+	MaxSeries int `yaml:"maxSeries"`
+	// HourlyLoad is the fraction of the series of every metric recorded in
+	// each hour of the local day, 24 entries from midnight on. Empty records
+	// all series around the clock.
+	HourlyLoad []float64 `yaml:"hourlyLoad"`
+	// MinMetrics and MaxMetrics give every service a random number of
+	// metrics in [MinMetrics, MaxMetrics] instead of the fixed metrics
+	// count. Zero uses the fixed count.
+	MinMetrics int `yaml:"minMetrics"`
+	MaxMetrics int `yaml:"maxMetrics"`
+	// MonotonicFraction is the fraction of the counters that stay monotonic
+	// sums, the others are generated as up-down counters. Unset keeps all
+	// counters monotonic.
+	MonotonicFraction *float64 `yaml:"monotonicFraction"`
+	// Entities are attached as entity references to the resources that
+	// have all their identifying attributes. Empty attaches none.
+	Entities []entityConfig `yaml:"entities"`
+
+	metricOptions `yaml:",inline"`
+}
+
+// Instrument types that can be generated.
+const (
+	metricGauge         = "gauge"
+	metricCounter       = "counter"
+	metricUpDownCounter = "updowncounter"
+	metricHistogram     = "histogram"
+)
+
+// defaultBuckets are the explicit bucket boundaries the SDK uses for
+// histograms without configured buckets.
+var defaultBuckets = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// defaultObservations is the number of observations a histogram records per
+// series and tick.
+const defaultObservations = 10
+
+// Value patterns that can be generated.
+const (
+	patternRandom     = "random"
+	patternRandomWalk = "randomwalk"
+	patternTimestamp  = "timestamp"
+)
+
+// metricsConfig is either the number of metrics to generate, named
+// metric-0000, metric-0001, ..., or a list of explicit metric definitions.
+type metricsConfig struct {
+	Count       int
+	Definitions []metricConfig
+}
+
+func (m *metricsConfig) UnmarshalYAML(unmarshal func(any) error) error {
+	*m = metricsConfig{}
+	if err := unmarshal(&m.Count); err == nil {
+		return nil
+	}
+	return unmarshal(&m.Definitions)
+}
+
+// metricConfig defines one metric.
+type metricConfig struct {
+	Name        string `yaml:"name"`
+	Unit        string `yaml:"unit"`
+	Description string `yaml:"description"`
+	// Attributes are added to the top-level attributes for this metric. An
+	// attribute with the name of a top-level attribute replaces it.
+	Attributes []attributeConfig `yaml:"attributes"`
+
+	metricOptions `yaml:",inline"`
+}
+
+// metrics returns the metrics to generate: the explicit definitions with
+// the top-level options as defaults and their attributes layered on the
+// top-level attributes, or count metrics with the top-level options.
+func (c config) metrics(count int) []metricConfig {
+	if len(c.Metrics.Definitions) == 0 {
+		metrics := make([]metricConfig, count)
+		for i := range metrics {
+			metrics[i] = metricConfig{Name: fmt.Sprintf("metric-%04d", i), metricOptions: c.metricOptions}
+		}
+		return c.splitSums(metrics)
+	}
+	metrics := slices.Clone(c.Metrics.Definitions)
+	for i := range metrics {
+		metrics[i].metricOptions = metrics[i].withDefaults(c.metricOptions)
+		if metrics[i].Attributes != nil {
+			metrics[i].Attributes = mergeAttributes(c.Attributes, metrics[i].Attributes, mergeAppend)
+		}
+	}
+	return c.splitSums(metrics)
+}
+
+// splitSums turns the counters beyond MonotonicFraction into up-down
+// counters. The monotonic ones are spread evenly over the counters, so that
+// every prefix of the metrics has about the same split. An up-down counter
+// without a negative min records changes in [-max, max), so that its sum
+// goes down as well as up.
+func (c config) splitSums(metrics []metricConfig) []metricConfig {
+	if c.MonotonicFraction == nil {
+		return metrics
+	}
+	f := *c.MonotonicFraction
+	j := 0
+	for i := range metrics {
+		if metrics[i].Type != metricCounter {
+			continue
+		}
+		if int(float64(j+1)*f+0.5) == int(float64(j)*f+0.5) {
+			metrics[i].Type = metricUpDownCounter
+			if lo, hi := metrics[i].bounds(); lo >= 0 {
+				lo = -hi
+				metrics[i].Min = &lo
+			}
+		}
+		j++
+	}
+	return metrics
+}
+
+// Thresholds above which the startup summary warns about the cardinality of
+// a config.
+const (
+	warnSeries               = 1_000_000
+	warnAttributeCardinality = 10_000
+)
+
+// cardinalityWarnings returns warnings about attributes with a cardinality
+// above warnAttributeCardinality, and about totalSeries above limit. The
+// latter suggests the attribute whose reduction removes the most series and
+// the cardinality that would bring the series down to limit. The series of
+// all services and scopes scale like the series of one service, so the
+// suggestion is computed from the metrics of one service.
+func (c config) cardinalityWarnings(totalSeries, limit int) []string {
+	var warnings []string
+	metrics := c.metrics(c.Metrics.Count)
+	perService := 0
+	with := make(map[string]int)
+	cardinalities := make(map[string]int)
+	for _, m := range metrics {
+		attrs := c.Attributes
+		if m.Attributes != nil {
+			attrs = m.Attributes
+		}
+		series := cardinality(attrs)
+		perService += series
+		for _, a := range attrs {
+			// Power law values do not multiply the series.
+			if a.pareto() {
+				continue
+			}
+			with[a.Name] += series
+			cardinalities[a.Name] = max(cardinalities[a.Name], a.Cardinality)
+		}
+	}
+	names := slices.Sorted(maps.Keys(cardinalities))
+	for _, name := range names {
+		if n := cardinalities[name]; n > warnAttributeCardinality {
+			warnings = append(warnings, fmt.Sprintf("attribute %s has a cardinality of %d, above %d", name, n, warnAttributeCardinality))
+		}
+	}
+	if totalSeries <= limit || perService == 0 {
+		return warnings
+	}
+
+	// Reducing an attribute to a cardinality of one removes the most series.
+	best, removed := "", 0.0
+	for _, name := range names {
+		n := float64(cardinalities[name])
+		if r := float64(with[name]) * (n - 1) / n; r > removed {
+			best, removed = name, r
+		}
+	}
+	warning := fmt.Sprintf("%d series exceed %d", totalSeries, limit)
+	if best == "" {
+		warnings = append(warnings, warning+", reduce the number of services or metrics")
+		return warnings
+	}
+	n := cardinalities[best]
+	fraction := float64(with[best]) / float64(perService)
+	rest := float64(totalSeries) * (1 - fraction)
+	if k := int(float64(n) * (float64(limit) - rest) / (float64(totalSeries) * fraction)); k >= 1 {
+		warning += fmt.Sprintf(", reduce the cardinality of attribute %s from %d to %d or less", best, n, k)
+	} else {
+		warning += fmt.Sprintf(", even a cardinality of 1 of attribute %s, the largest contributor, leaves %.0f series, reduce the number of services or metrics", best, rest+float64(totalSeries)*fraction/float64(n))
+	}
+	return append(warnings, warning)
+}
+
+// tenantConfig describes a tenant with its own credentials and services.
+type tenantConfig struct {
+	Name string `yaml:"name"`
+	// Token, or Username and Password, replace the command line credentials.
+	Token    string `yaml:"token"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Headers are added to every export request of the tenant.
+	Headers map[string]string `yaml:"headers"`
+	// Services and Metrics default to the top-level counts.
+	Services int `yaml:"services"`
+	Metrics  int `yaml:"metrics"`
+}
+
+// transportConfig describes a protocol and endpoint used by a fraction of
+// the services.
+type transportConfig struct {
+	// Protocol is grpc or http.
+	Protocol string `yaml:"protocol"`
+	// Endpoint replaces -endpoint for the services of the transport.
+	Endpoint string `yaml:"endpoint"`
+	// Fraction of the services using the transport. The fractions of all
+	// transports add up to 1.
+	Fraction float64 `yaml:"fraction"`
+}
+
+// assignTransports returns the index of the transport of each of n
+// services, nil without transports. The services of each transport are
+// spread evenly over the services, so every transport has services of every
+// tenant, and the counts are the fractions rounded so they add up to n.
+func (c config) assignTransports(n int) []int {
+	if len(c.Transports) == 0 {
+		return nil
+	}
+	assigned := make([]int, n)
+	counts := make([]int, len(c.Transports))
+	for i := range assigned {
+		// Each service goes to the transport furthest behind its share.
+		best, behind := 0, math.Inf(-1)
+		for t, transport := range c.Transports {
+			if d := transport.Fraction*float64(i+1) - float64(counts[t]); d > behind {
+				best, behind = t, d
+			}
+		}
+		assigned[i] = best
+		counts[best]++
+	}
+	return assigned
+}
+
+// entityConfig describes an entity reference of the resources, which names
+// the resource attributes that identify and describe an entity.
+type entityConfig struct {
+	// Type of the entity, e.g. service or host.
+	Type      string `yaml:"type"`
+	SchemaURL string `yaml:"schemaURL"`
+	// IDKeys are the attributes identifying the entity, at least one.
+	IDKeys []string `yaml:"idKeys"`
+	// DescriptionKeys are the attributes describing the entity. Keys that
+	// a resource does not have are left out of its reference.
+	DescriptionKeys []string `yaml:"descriptionKeys"`
+}
+
+// metricOptions controls how values are produced for the generated metrics.
+type metricOptions struct {
+	// Type is the instrument type, gauge (the default), counter,
+	// updowncounter or histogram.
+	Type string `yaml:"type"`
+	// Pattern is how values evolve over time: random (the default) draws a
+	// fresh uniform value in [Min, Max) on every tick, randomwalk moves each
+	// series by a random step of at most Step from its previous value.
+	Pattern string `yaml:"pattern"`
+	// Min and Max bound the generated values, [0, 1) by default.
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+	// Step is the largest change of a random walk per tick, a tenth of the
+	// value range by default.
+	Step *float64 `yaml:"step"`
+	// Precision is the number of decimal places recorded values are rounded
+	// to. Nil keeps full precision.
+	Precision *int `yaml:"precision"`
+	// Rate is the increase of a counter in units per second of event time.
+	// Nil adds a random delta in [Min, Max) on every tick.
+	Rate *float64 `yaml:"rate"`
+	// Buckets are the explicit bucket boundaries of histograms, the SDK
+	// defaults if empty.
+	Buckets []float64 `yaml:"buckets"`
+	// BucketCounts is the exact number of observations recorded into each
+	// histogram bucket per tick, one more than there are boundaries. Nil
+	// records Observations random observations per tick.
+	BucketCounts []uint64 `yaml:"bucketCounts"`
+	// Observations is the number of observations a histogram records per
+	// series and tick, defaultObservations if zero. Without a value range,
+	// distribution or expr they are spread evenly over the buckets.
+	Observations int `yaml:"observations"`
+	// Expr is an expression computing the recorded value, in place of
+	// Pattern, Min and Max. See exprEnv for its variables and functions.
+	Expr string `yaml:"expr"`
+	// EmitProbability is the probability that the metric is recorded in an
+	// interval, for all of its series at once. Nil records it every interval.
+	EmitProbability *float64 `yaml:"emitProbability"`
+	// Lifetime is how long after the start the metric is recorded before it
+	// goes silent, and ResumeAfter how long it stays silent before it is
+	// recorded for another Lifetime, over and over. A zero Lifetime records
+	// it forever, a zero ResumeAfter never resumes it.
+	Lifetime    time.Duration `yaml:"lifetime"`
+	ResumeAfter time.Duration `yaml:"resumeAfter"`
+	// Distribution draws the random values from a statistical distribution,
+	// or computes them from the elapsed time, instead of uniformly from
+	// [Min, Max).
+	Distribution *distributionConfig `yaml:"distribution"`
+	// NaNFraction is the fraction of the observations of a histogram that
+	// are recorded as NaN instead of their value.
+	NaNFraction float64 `yaml:"nanFraction"`
+}
+
+// Statistical distributions values can be drawn from.
+const (
+	distributionNormal      = "normal"
+	distributionLognormal   = "lognormal"
+	distributionExponential = "exponential"
+	distributionPareto      = "pareto"
+	distributionUniform     = "uniform"
+	// Sine and ramp values are functions of the elapsed time.
+	distributionSine = "sine"
+	distributionRamp = "ramp"
+)
+
+// distributionConfig is a statistical distribution and its parameters. Each
+// distribution only uses its own parameters.
+type distributionConfig struct {
+	Type string `yaml:"type"`
+	// Mean and Stddev parameterize the normal distribution.
+	Mean   float64 `yaml:"mean"`
+	Stddev float64 `yaml:"stddev"`
+	// Mu and Sigma are the mean and standard deviation of the logarithm of
+	// lognormal values.
+	Mu    float64 `yaml:"mu"`
+	Sigma float64 `yaml:"sigma"`
+	// Lambda is the rate of the exponential distribution, its mean is
+	// 1/Lambda.
+	Lambda float64 `yaml:"lambda"`
+	// Scale is the smallest value of the Pareto distribution and Shape its
+	// tail index, smaller shapes have heavier tails.
+	Scale float64 `yaml:"scale"`
+	Shape float64 `yaml:"shape"`
+	// Min and Max are the range of uniform values, [Min, Max).
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+	// Offset is the center of the sine wave and the value the ramp starts
+	// from.
+	Offset float64 `yaml:"offset"`
+	// Period and Amplitude shape the sine wave.
+	Period    time.Duration `yaml:"period"`
+	Amplitude float64       `yaml:"amplitude"`
+	// Slope is the increase of the ramp per second, which starts over every
+	// Reset unless it is zero.
+	Slope float64       `yaml:"slope"`
+	Reset time.Duration `yaml:"reset"`
+	// Phase shifts the sine wave and the ramp by a fraction of their Period
+	// or Reset, and ServicePhase and SeriesPhase by a further fraction per
+	// service and series index, so that the series are shifted copies of
+	// one wave.
+	Phase        float64 `yaml:"phase"`
+	ServicePhase float64 `yaml:"servicePhase"`
+	SeriesPhase  float64 `yaml:"seriesPhase"`
+}
+
+func (d distributionConfig) validate() error {
+	switch d.Type {
+	case distributionNormal:
+		if d.Stddev <= 0 {
+			return fmt.Errorf("invalid stddev %g: must be positive", d.Stddev)
+		}
+	case distributionLognormal:
+		if d.Sigma <= 0 {
+			return fmt.Errorf("invalid sigma %g: must be positive", d.Sigma)
+		}
+	case distributionExponential:
+		if d.Lambda <= 0 {
+			return fmt.Errorf("invalid lambda %g: must be positive", d.Lambda)
+		}
+	case distributionPareto:
+		if d.Scale <= 0 || d.Shape <= 0 {
+			return fmt.Errorf("invalid scale %g and shape %g: must be positive", d.Scale, d.Shape)
+		}
+	case distributionUniform:
+		if d.Max <= d.Min {
+			return fmt.Errorf("invalid min %g and max %g: max must be larger", d.Min, d.Max)
+		}
+	case distributionSine:
+		if d.Period <= 0 {
+			return fmt.Errorf("invalid period %s: must be positive", d.Period)
+		}
+	case distributionRamp:
+		if d.Reset < 0 {
+			return fmt.Errorf("invalid reset %s: must not be negative", d.Reset)
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q, must be %s, %s, %s, %s, %s, %s or %s", d.Type,
+			distributionNormal, distributionLognormal, distributionExponential, distributionPareto,
+			distributionUniform, distributionSine, distributionRamp)
+	}
+	return nil
+}
+
+// negative reports whether the distribution has negative values.
+func (d distributionConfig) negative() bool {
+	switch d.Type {
+	case distributionNormal:
+		return true
+	case distributionUniform:
+		return d.Min < 0
+	case distributionSine:
+		return d.Offset-math.Abs(d.Amplitude) < 0
+	case distributionRamp:
+		return d.Offset < 0 || d.Slope < 0
+	default:
+		return false
+	}
+}
+
+// bounds returns the value range.
+func (o metricOptions) bounds() (lo, hi float64) {
+	lo, hi = 0, 1
+	if o.Min != nil {
+		lo = *o.Min
+	}
+	if o.Max != nil {
+		hi = *o.Max
+	}
+	return lo, hi
+}
+
+// step returns the largest change of a random walk per tick.
+func (o metricOptions) step() float64 {
+	if o.Step != nil {
+		return *o.Step
+	}
+	lo, hi := o.bounds()
+	return (hi - lo) / 10
+}
+
+func (o metricOptions) validate() error {
+	switch o.Type {
+	case "", metricGauge, metricCounter, metricUpDownCounter, metricHistogram:
+	default:
+		return fmt.Errorf("unknown metric type %q", o.Type)
+	}
+	switch o.Pattern {
+	case "", patternRandom:
+	case patternRandomWalk:
+		if o.Type == metricCounter || o.Type == metricUpDownCounter {
+			return fmt.Errorf("pattern %s cannot be used with type %s or %s", o.Pattern, metricCounter, metricUpDownCounter)
+		}
+	case patternTimestamp:
+		if cmp.Or(o.Type, metricGauge) != metricGauge {
+			return fmt.Errorf("pattern %s requires type %s", o.Pattern, metricGauge)
+		} else if o.Distribution != nil || o.Expr != "" {
+			return fmt.Errorf("pattern %s cannot be combined with distribution or expr", o.Pattern)
+		}
+	default:
+		return fmt.Errorf("unknown pattern %q", o.Pattern)
+	}
+	if lo, hi := o.bounds(); lo >= hi {
+		return fmt.Errorf("invalid value range: min %g must be less than max %g", lo, hi)
+	} else if lo < 0 && o.Type == metricCounter {
+		return fmt.Errorf("invalid min %g: counters cannot decrease", lo)
+	}
+	if o.step() <= 0 {
+		return fmt.Errorf("invalid step %g: must be positive", o.step())
+	}
+	if o.Precision != nil && *o.Precision < 0 {
+		return fmt.Errorf("invalid precision %d: must not be negative", *o.Precision)
+	}
+	if o.Rate != nil {
+		if o.Type != metricCounter {
+			return fmt.Errorf("rate requires type %s", metricCounter)
+		}
+		if *o.Rate < 0 {
+			return fmt.Errorf("invalid rate %g: counters cannot decrease", *o.Rate)
+		}
+	}
+	if (o.Buckets != nil || o.BucketCounts != nil || o.Observations != 0) && o.Type != metricHistogram {
+		return fmt.Errorf("buckets, bucketCounts and observations require type %s", metricHistogram)
+	} else if o.Observations < 0 {
+		return fmt.Errorf("invalid observations %d: must not be negative", o.Observations)
+	} else if o.Observations > 0 && o.BucketCounts != nil {
+		return fmt.Errorf("observations cannot be combined with bucketCounts")
+	}
+	for i := 1; i < len(o.Buckets); i++ {
+		if o.Buckets[i] <= o.Buckets[i-1] {
+			return fmt.Errorf("invalid buckets %v: boundaries must be increasing", o.Buckets)
+		}
+	}
+	if o.BucketCounts != nil && len(o.BucketCounts) != len(o.buckets())+1 {
+		return fmt.Errorf("invalid bucketCounts: %d counts for %d buckets, expected %d",
+			len(o.BucketCounts), len(o.buckets())+1, len(o.buckets())+1)
+	}
+	if o.NaNFraction < 0 || o.NaNFraction > 1 {
+		return fmt.Errorf("invalid nanFraction %g: must be between 0 and 1", o.NaNFraction)
+	} else if o.NaNFraction > 0 && o.Type != metricHistogram {
+		return fmt.Errorf("nanFraction requires type %s", metricHistogram)
+	}
+	if p := o.EmitProbability; p != nil && (*p < 0 || *p > 1) {
+		return fmt.Errorf("invalid emitProbability %g: must be between 0 and 1", *p)
+	}
+	if o.Lifetime < 0 || o.ResumeAfter < 0 {
+		return fmt.Errorf("invalid lifetime %s and resumeAfter %s: must not be negative", o.Lifetime, o.ResumeAfter)
+	} else if o.ResumeAfter > 0 && o.Lifetime == 0 {
+		return fmt.Errorf("resumeAfter requires a lifetime")
+	}
+	if d := o.Distribution; d != nil {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("distribution: %w", err)
+		}
+		if o.Pattern == patternRandomWalk || o.Rate != nil || o.BucketCounts != nil || o.Expr != "" {
+			return fmt.Errorf("distribution cannot be combined with pattern %s, rate, bucketCounts or expr", patternRandomWalk)
+		}
+		if d.negative() && o.Type == metricCounter {
+			return fmt.Errorf("distribution %s with negative values requires type %s, %s or %s: counters cannot decrease", d.Type, metricGauge, metricUpDownCounter, metricHistogram)
+		}
+	}
+	if o.Expr != "" {
+		if o.Pattern == patternRandomWalk || o.Rate != nil || o.BucketCounts != nil {
+			return fmt.Errorf("expr cannot be combined with pattern %s, rate or bucketCounts", patternRandomWalk)
+		}
+		if _, err := compileExpr(o.Expr); err != nil {
+			return fmt.Errorf("invalid expr: %w", err)
+		}
+	}
+	return nil
+}
+
+// emitting reports whether the metric is recorded at elapsed since the
+// start, following its Lifetime and ResumeAfter.
+func (o metricOptions) emitting(elapsed time.Duration) bool {
+	if o.Lifetime <= 0 {
+		return true
+	}
+	if o.ResumeAfter > 0 {
+		elapsed %= o.Lifetime + o.ResumeAfter
+	}
+	return elapsed < o.Lifetime
+}
+
+// buckets returns the histogram bucket boundaries.
+func (o metricOptions) buckets() []float64 {
+	if len(o.Buckets) > 0 {
+		return o.Buckets
+	}
+	return defaultBuckets
+}
+
+// observations returns the number of observations recorded per series and
+// tick, one for instruments other than histograms.
+func (o metricOptions) observations() int {
+	if o.Type != metricHistogram {
+		return 1
+	}
+	return cmp.Or(o.Observations, defaultObservations)
+}
+
+// spread reports whether the observations of a histogram are spread over
+// its buckets, when nothing else sets the values.
+func (o metricOptions) spread() bool {
+	return o.Type == metricHistogram && o.Min == nil && o.Max == nil && o.Rate == nil &&
+		o.Distribution == nil && o.Expr == "" && cmp.Or(o.Pattern, patternRandom) == patternRandom
+}
+
+// bucketValues returns the observations that fill the histogram buckets
+// with exactly BucketCounts observations each. Bucket i holds values in
+// (buckets[i-1], buckets[i]], so the first bucket is filled with its upper
+// boundary, inner buckets with their midpoint and the last bucket with its
+// lower boundary plus one.
+func (o metricOptions) bucketValues() []float64 {
+	b := o.buckets()
+	var values []float64
+	for i, n := range o.BucketCounts {
+		var v float64
+		switch i {
+		case 0:
+			v = b[0]
+		case len(b):
+			v = b[len(b)-1] + 1
+		default:
+			v = (b[i-1] + b[i]) / 2
+		}
+		for range n {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// withDefaults fills the options o leaves unset from defaults. Options of
+// a different instrument type are not inherited, they would not apply.
+func (o metricOptions) withDefaults(defaults metricOptions) metricOptions {
+	if o.Type != "" && o.Type != cmp.Or(defaults.Type, metricGauge) {
+		return o
+	}
+	o.Type = cmp.Or(o.Type, defaults.Type)
+	o.Pattern = cmp.Or(o.Pattern, defaults.Pattern)
+	o.Min = cmp.Or(o.Min, defaults.Min)
+	o.Max = cmp.Or(o.Max, defaults.Max)
+	o.Step = cmp.Or(o.Step, defaults.Step)
+	o.Precision = cmp.Or(o.Precision, defaults.Precision)
+	o.Rate = cmp.Or(o.Rate, defaults.Rate)
+	o.Expr = cmp.Or(o.Expr, defaults.Expr)
+	o.EmitProbability = cmp.Or(o.EmitProbability, defaults.EmitProbability)
+	o.Lifetime = cmp.Or(o.Lifetime, defaults.Lifetime)
+	o.ResumeAfter = cmp.Or(o.ResumeAfter, defaults.ResumeAfter)
+	o.Distribution = cmp.Or(o.Distribution, defaults.Distribution)
+	o.NaNFraction = cmp.Or(o.NaNFraction, defaults.NaNFraction)
+	if o.Buckets == nil {
+		o.Buckets = defaults.Buckets
+	}
+	// The observations of a histogram are either counted per bucket or
+	// random, whichever the metric sets.
+	if o.BucketCounts == nil && o.Observations == 0 {
+		o.BucketCounts, o.Observations = defaults.BucketCounts, defaults.Observations
+	}
+	return o
+}
+
+// conflicting returns the options of the same metrics with a different
+// instrument type: gauges become counters, counters and histograms become
+// gauges. Settings that only apply to the original type are dropped.
+func (o metricOptions) conflicting() metricOptions {
+	if o.Type == "" || o.Type == metricGauge {
+		o.Type = metricCounter
+		o.Pattern, o.Step = "", nil
+		if lo, _ := o.bounds(); lo < 0 {
+			o.Min = nil
+		}
+		if o.Distribution != nil && o.Distribution.negative() {
+			o.Distribution = nil
+		}
+	} else {
+		o.Type = metricGauge
+		o.Rate, o.NaNFraction = nil, 0
+	}
+	o.Buckets, o.BucketCounts, o.Observations = nil, nil, 0
+	return o
+}
+
+// quantize rounds v to the configured precision.
+func (o metricOptions) quantize(v float64) float64 {
+	if o.Precision == nil {
+		return v
+	}
+	scale := math.Pow10(*o.Precision)
+	return math.Round(v*scale) / scale
+}
+
+type attributeConfig struct {
+	Name        string `yaml:"name"`
+	Cardinality int    `yaml:"cardinality"`
+	// Template formats the attribute values, see templateVariables.
+	// Empty uses the zero-padded value index.
+	Template string `yaml:"template"`
+	// ChangeEvery and ChangeProbability make a resource attribute change
+	// over time, every ChangeEvery intervals or with ChangeProbability in
+	// each interval. A change advances the attribute to its next value.
+	ChangeEvery       int     `yaml:"changeEvery"`
+	ChangeProbability float64 `yaml:"changeProbability"`
+	// KeyLength pads the attribute key with x to this many bytes, for
+	// testing key length limits. Zero and lengths shorter than the name
+	// keep the name as is.
+	KeyLength int `yaml:"keyLength"`
+	// OmitProbability is the probability that the attribute is left out of
+	// a data point, so the data points of a metric have different attribute
+	// keys. Only data point attributes can be omitted.
+	OmitProbability float64 `yaml:"omitProbability"`
+	// EmptyProbability is the probability that the attribute has the empty
+	// string as its value on a data point, keeping the key. Only data point
+	// attributes can be empty.
+	EmptyProbability float64 `yaml:"emptyProbability"`
+	// ParetoAlpha draws the value of the attribute from its Cardinality
+	// values for every combination of the other attributes, instead of
+	// generating each combination with every value. Value k is drawn with
+	// a probability proportional to (k+1)^-(1+ParetoAlpha), a power law in
+	// which a few values are on most series. Zero generates every value.
+	ParetoAlpha float64 `yaml:"paretoAlpha"`
+}
+
+// key returns the attribute key, the name padded to KeyLength.
+func (a attributeConfig) key() string {
+	if len(a.Name) >= a.KeyLength {
+		return a.Name
+	}
+	return a.Name + strings.Repeat("x", a.KeyLength-len(a.Name))
+}
+
+// pareto reports whether the attribute values follow a power law.
+func (a attributeConfig) pareto() bool {
+	return a.ParetoAlpha > 0
+}
+
+// changes reports whether the attribute value changes over time.
+func (a attributeConfig) changes() bool {
+	return a.ChangeEvery != 0 || a.ChangeProbability != 0
+}
+
+// Attribute value modes select whether services share attribute values.
+const (
+	// valuesShared gives every service the same value space, so a value like
+	// region=000000001 appears on the series of all services and joins on
+	// attribute values match across services.
+	valuesShared = "shared"
+	// valuesOffset shifts the value indexes of each service past those of
+	// the previous services, so value 000000000 of service 5 becomes
+	// 5*cardinality. Values keep their numeric format but the value spaces
+	// of services are disjoint.
+	valuesOffset = "offset"
+	// valuesUnique prefixes values with the service name, so no two services
+	// ever emit the same attribute value.
+	valuesUnique = "unique"
+)
+
+// templateVariables are the placeholders available in attribute templates.
+var templateVariables = []string{"{{service}}", "{{index}}"}
+
+// value returns the i-th value of the attribute for the given service.
+// Templated attributes ignore the value mode, their template decides
+// whether values differ between services.
+func (a attributeConfig) value(i int, mode string, svc service) string {
+	if a.Template == "" {
+		switch mode {
+		case valuesOffset:
+			return fmt.Sprintf("%09d", svc.index*a.Cardinality+i)
+		case valuesUnique:
+			return fmt.Sprintf("%s-%09d", svc.name, i)
+		default:
+			return fmt.Sprintf("%09d", i)
+		}
+	}
+	return strings.NewReplacer(
+		"{{service}}", svc.name,
+		"{{index}}", strconv.Itoa(i),
+	).Replace(a.Template)
+}
+
+func (a attributeConfig) validate() error {
+	t := a.Template
+	for _, v := range templateVariables {
+		t = strings.ReplaceAll(t, v, "")
+	}
+	if strings.Contains(t, "{{") {
+		return fmt.Errorf("attribute %s: unknown variable in template %q, available variables are %s",
+			a.Name, a.Template, strings.Join(templateVariables, ", "))
+	}
+	if a.ChangeEvery < 0 {
+		return fmt.Errorf("attribute %s: invalid changeEvery %d: must not be negative", a.Name, a.ChangeEvery)
+	}
+	if a.ChangeProbability < 0 || a.ChangeProbability > 1 {
+		return fmt.Errorf("attribute %s: invalid changeProbability %g: must be between 0 and 1", a.Name, a.ChangeProbability)
+	}
+	if a.OmitProbability < 0 || a.OmitProbability > 1 {
+		return fmt.Errorf("attribute %s: invalid omitProbability %g: must be between 0 and 1", a.Name, a.OmitProbability)
+	}
+	if a.EmptyProbability < 0 || a.EmptyProbability > 1 {
+		return fmt.Errorf("attribute %s: invalid emptyProbability %g: must be between 0 and 1", a.Name, a.EmptyProbability)
+	}
+	if a.ParetoAlpha < 0 {
+		return fmt.Errorf("attribute %s: invalid paretoAlpha %g: must not be negative", a.Name, a.ParetoAlpha)
+	}
+	if a.KeyLength < 0 {
+		return fmt.Errorf("attribute %s: invalid keyLength %d: must not be negative", a.Name, a.KeyLength)
+	}
+	if a.changes() && a.Cardinality < 2 {
+		return fmt.Errorf("attribute %s: changing values require a cardinality of at least 2", a.Name)
+	}
+	if a.pareto() && a.Cardinality < 2 {
+		return fmt.Errorf("attribute %s: paretoAlpha requires a cardinality of at least 2", a.Name)
+	}
+	return nil
+}
+
+// Merge strategies for the attributes list when several config files are
+// layered on top of each other.
+const (
+	// mergeAppend keeps the attributes of earlier files and adds those of
+	// later files. An attribute whose name already exists replaces the
+	// earlier definition in place, so overlays can adjust cardinality.
+	mergeAppend = "append"
+	// mergeReplace discards the attributes of earlier files whenever a later
+	// file defines an attributes list (an empty list clears them).
+	mergeReplace = "replace"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// loadConfig reads the config files in order and merges each one over the
+// result of the previous ones. Scalar fields present in a later file
+// overwrite earlier values, fields it omits are left untouched. The
+// attribute lists are merged according to strategy.
+func loadConfig(files []string, strategy string) (config, error) {
+	var cfg config
+	switch strategy {
+	case mergeAppend, mergeReplace:
+	default:
+		return cfg, fmt.Errorf("unknown config merge strategy %q", strategy)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		prev, prevResource := cfg.Attributes, cfg.ResourceAttributes
+		cfg.Attributes, cfg.ResourceAttributes = nil, nil
+		err = yaml.NewDecoder(f).Decode(&cfg)
+		f.Close()
+		if err != nil {
+			return cfg, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		cfg.Attributes = mergeAttributes(prev, cfg.Attributes, strategy)
+		cfg.ResourceAttributes = mergeAttributes(prevResource, cfg.ResourceAttributes, strategy)
+	}
+	return cfg, nil
+}
+
+// mergeAttributes merges the attributes defined by an overlay into base.
+// A nil overlay means the file did not define attributes at all.
+func mergeAttributes(base, overlay []attributeConfig, strategy string) []attributeConfig {
+	if overlay == nil {
+		return base
+	}
+	if strategy == mergeReplace {
+		return overlay
+	}
+	merged := slices.Clone(base)
+	for _, attr := range overlay {
+		i := slices.IndexFunc(merged, func(a attributeConfig) bool { return a.Name == attr.Name })
+		if i >= 0 {
+			merged[i] = attr
+		} else {
+			merged = append(merged, attr)
+		}
+	}
+	return merged
+}
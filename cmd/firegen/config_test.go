@@ -0,0 +1,252 @@
+package main
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadConfigMerge(t *testing.T) {
+	base := writeConfig(t, "base.yaml", `
+metrics: 2
+interval: 10
+services: 3
+attributes:
+  - name: region
+    cardinality: 2
+  - name: pod
+    cardinality: 3
+`)
+	overlay := writeConfig(t, "overlay.yaml", `
+services: 5
+attributes:
+  - name: pod
+    cardinality: 10
+  - name: zone
+    cardinality: 4
+`)
+
+	cfg, err := loadConfig([]string{base, overlay}, mergeAppend)
+	require.NoError(t, err)
+	assert.Equal(t, config{
+		Metrics:  metricsConfig{Count: 2},
+		Interval: 10,
+		Services: 5,
+		Attributes: []attributeConfig{
+			{Name: "region", Cardinality: 2},
+			{Name: "pod", Cardinality: 10},
+			{Name: "zone", Cardinality: 4},
+		},
+	}, cfg)
+
+	cfg, err = loadConfig([]string{base, overlay}, mergeReplace)
+	require.NoError(t, err)
+	assert.Equal(t, []attributeConfig{{Name: "pod", Cardinality: 10}, {Name: "zone", Cardinality: 4}}, cfg.Attributes)
+}
+
+func TestLoadConfigOverlayWithoutAttributes(t *testing.T) {
+	base := writeConfig(t, "base.yaml", "attributes:\n  - name: region\n    cardinality: 2\n")
+	overlay := writeConfig(t, "overlay.yaml", "interval: 5\n")
+
+	for _, strategy := range []string{mergeAppend, mergeReplace} {
+		cfg, err := loadConfig([]string{base, overlay}, strategy)
+		require.NoError(t, err)
+		assert.Equal(t, 5, cfg.Interval)
+		assert.Equal(t, []attributeConfig{{Name: "region", Cardinality: 2}}, cfg.Attributes)
+	}
+}
+
+func TestLoadConfigUnknownStrategy(t *testing.T) {
+	_, err := loadConfig(nil, "bogus")
+	assert.Error(t, err)
+}
+
+func TestQuantize(t *testing.T) {
+	assert.Equal(t, 0.123456789, metricOptions{}.quantize(0.123456789))
+
+	precision := 2
+	assert.Equal(t, 0.12, metricOptions{Precision: &precision}.quantize(0.123456789))
+	assert.Equal(t, 0.13, metricOptions{Precision: &precision}.quantize(0.125001))
+
+	precision = 0
+	assert.Equal(t, 1.0, metricOptions{Precision: &precision}.quantize(0.6))
+}
+
+func TestMetricOptionsValidate(t *testing.T) {
+	rate := 5.0
+	assert.NoError(t, metricOptions{}.validate())
+	assert.NoError(t, metricOptions{Type: metricCounter, Rate: &rate}.validate())
+	assert.Error(t, metricOptions{Type: "summary"}.validate())
+	assert.Error(t, metricOptions{Rate: &rate}.validate())
+
+	half, tooHigh := 0.5, 1.5
+	assert.NoError(t, metricOptions{EmitProbability: &half}.validate())
+	assert.Error(t, metricOptions{EmitProbability: &tooHigh}.validate())
+
+	assert.NoError(t, metricOptions{Lifetime: time.Minute, ResumeAfter: time.Minute}.validate())
+	assert.Error(t, metricOptions{Lifetime: -time.Minute}.validate())
+	assert.Error(t, metricOptions{ResumeAfter: time.Minute}.validate())
+}
+
+func TestMetricOptionsEmitting(t *testing.T) {
+	forever := metricOptions{}
+	once := metricOptions{Lifetime: 10 * time.Minute}
+	cycle := metricOptions{Lifetime: 10 * time.Minute, ResumeAfter: 5 * time.Minute}
+	for _, test := range []struct {
+		elapsed     time.Duration
+		once, cycle bool
+	}{
+		{0, true, true},
+		{9 * time.Minute, true, true},
+		{10 * time.Minute, false, false},
+		{14 * time.Minute, false, false},
+		{15 * time.Minute, false, true},
+		{24 * time.Minute, false, true},
+		{25 * time.Minute, false, false},
+	} {
+		assert.True(t, forever.emitting(test.elapsed))
+		assert.Equal(t, test.once, once.emitting(test.elapsed), "once at %s", test.elapsed)
+		assert.Equal(t, test.cycle, cycle.emitting(test.elapsed), "cycle at %s", test.elapsed)
+	}
+}
+
+func TestBucketValues(t *testing.T) {
+	opts := metricOptions{Type: metricHistogram, Buckets: []float64{1, 5, 10}, BucketCounts: []uint64{1, 2, 0, 1}}
+	require.NoError(t, opts.validate())
+	assert.Equal(t, []float64{1, 3, 3, 11}, opts.bucketValues())
+
+	assert.Error(t, metricOptions{Type: metricHistogram, BucketCounts: []uint64{1, 2}}.validate())
+	assert.Error(t, metricOptions{Type: metricHistogram, Buckets: []float64{5, 1}}.validate())
+	assert.Error(t, metricOptions{Buckets: []float64{1}}.validate())
+	assert.NoError(t, metricOptions{Type: metricHistogram, Observations: 3}.validate())
+	assert.Error(t, metricOptions{Observations: 3}.validate())
+	assert.Error(t, metricOptions{Type: metricHistogram, Observations: 3, BucketCounts: make([]uint64, len(defaultBuckets)+1)}.validate())
+	assert.NoError(t, metricOptions{Type: metricHistogram, Pattern: patternRandomWalk}.validate())
+	assert.EqualError(t, metricOptions{Type: metricUpDownCounter, Pattern: patternRandomWalk}.validate(), "pattern randomwalk cannot be used with type counter or updowncounter")
+}
+
+func TestMetricOptionsConflicting(t *testing.T) {
+	lo, rate := -1.0, 5.0
+	for _, opts := range []metricOptions{
+		{},
+		{Pattern: patternRandomWalk, Min: &lo},
+		{Type: metricCounter, Rate: &rate},
+		{Type: metricHistogram, Buckets: []float64{1}, BucketCounts: []uint64{1, 1}},
+	} {
+		conflicting := opts.conflicting()
+		assert.NotEqual(t, cmp.Or(opts.Type, metricGauge), conflicting.Type)
+		assert.NoError(t, conflicting.validate())
+	}
+}
+
+func TestLoadConfigMetricDefinitions(t *testing.T) {
+	base := writeConfig(t, "base.yaml", "metrics: 3\nmin: 10\nmax: 20\nattributes:\n  - name: region\n    cardinality: 2\n")
+	overlay := writeConfig(t, "overlay.yaml", `
+metrics:
+  - name: http.server.duration
+    unit: ms
+    description: Request duration
+    max: 50
+    attributes:
+      - name: route
+        cardinality: 4
+  - name: requests
+    type: counter
+    rate: 2
+    lifetime: 90s
+`)
+
+	cfg, err := loadConfig([]string{base}, mergeAppend)
+	require.NoError(t, err)
+	assert.Equal(t, metricsConfig{Count: 3}, cfg.Metrics)
+	assert.Len(t, cfg.metrics(cfg.Metrics.Count), 3)
+
+	cfg, err = loadConfig([]string{base, overlay}, mergeAppend)
+	require.NoError(t, err)
+	metrics := cfg.metrics(1)
+	require.Len(t, metrics, 2)
+
+	lo, hi, rate := 10.0, 50.0, 2.0
+	assert.Equal(t, metricConfig{
+		Name:          "http.server.duration",
+		Unit:          "ms",
+		Description:   "Request duration",
+		Attributes:    []attributeConfig{{Name: "region", Cardinality: 2}, {Name: "route", Cardinality: 4}},
+		metricOptions: metricOptions{Min: &lo, Max: &hi},
+	}, metrics[0])
+	// Counters do not inherit the options of the top-level gauges.
+	assert.Equal(t, metricOptions{Type: metricCounter, Rate: &rate, Lifetime: 90 * time.Second}, metrics[1].metricOptions)
+	assert.Nil(t, metrics[1].Attributes)
+}
+
+func TestConfigSplitSums(t *testing.T) {
+	fraction := 0.75
+	cfg := config{metricOptions: metricOptions{Type: metricCounter}, MonotonicFraction: &fraction}
+	var types []string
+	for _, m := range cfg.metrics(8) {
+		types = append(types, m.Type)
+	}
+	assert.Equal(t, []string{
+		metricCounter, metricCounter, metricUpDownCounter, metricCounter,
+		metricCounter, metricCounter, metricUpDownCounter, metricCounter,
+	}, types)
+
+	fraction = 0
+	assert.Equal(t, metricUpDownCounter, cfg.metrics(1)[0].Type)
+
+	cfg.MonotonicFraction = nil
+	assert.Equal(t, metricCounter, cfg.metrics(1)[0].Type)
+}
+
+func TestConfigAssignTransports(t *testing.T) {
+	assert.Nil(t, config{}.assignTransports(4))
+
+	cfg := config{Transports: []transportConfig{
+		{Protocol: protocolHTTP, Endpoint: "localhost:4318", Fraction: 0.25},
+		{Protocol: protocolGRPC, Endpoint: "localhost:4317", Fraction: 0.75},
+	}}
+	assert.Equal(t, []int{1, 0, 1, 1, 1, 0, 1, 1}, cfg.assignTransports(8))
+	assert.Equal(t, []int{1}, cfg.assignTransports(1))
+
+	cfg.Transports[0].Fraction, cfg.Transports[1].Fraction = 0.3, 0.7
+	counts := make([]int, 2)
+	for _, transport := range cfg.assignTransports(1000) {
+		counts[transport]++
+	}
+	assert.Equal(t, []int{300, 700}, counts)
+}
+
+func TestCardinalityWarnings(t *testing.T) {
+	cfg := config{
+		Metrics: metricsConfig{Count: 2},
+		Attributes: []attributeConfig{
+			{Name: "region", Cardinality: 4},
+			{Name: "pod", Cardinality: 20000},
+		},
+	}
+	total := 10 * 2 * 4 * 20000
+	assert.Equal(t, []string{
+		"attribute pod has a cardinality of 20000, above 10000",
+		"1600000 series exceed 1000000, reduce the cardinality of attribute pod from 20000 to 12500 or less",
+	}, cfg.cardinalityWarnings(total, 1_000_000))
+
+	assert.Equal(t, []string{
+		"attribute pod has a cardinality of 20000, above 10000",
+		"1600000 series exceed 10, even a cardinality of 1 of attribute pod, the largest contributor, leaves 80 series, reduce the number of services or metrics",
+	}, cfg.cardinalityWarnings(total, 10))
+
+	cfg.Attributes[1].Cardinality = 100
+	assert.Empty(t, cfg.cardinalityWarnings(8000, 1_000_000))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Modes of -corrupt-mode.
+const (
+	// corruptTruncate cuts the serialized protobuf request short inside its
+	// first resource.
+	corruptTruncate = "truncate"
+	// corruptGzip compresses every request with gzip and flips a byte of
+	// the compressed stream of the damaged ones.
+	corruptGzip = "gzip"
+)
+
+// corrupter damages a fraction of the serialized export requests for
+// negative testing of the receivers, with a gRPC codec or an HTTP
+// transport. It is safe for concurrent use.
+type corrupter struct {
+	mode        string
+	probability float64
+	corrupted   atomic.Int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newCorrupter(mode string, probability float64, seed int64) *corrupter {
+	return &corrupter{mode: mode, probability: probability, rng: rand.New(rand.NewSource(seed))}
+}
+
+// draw reports whether the next request is damaged and returns a random
+// number for where.
+func (c *corrupter) draw() (bool, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rng.Float64() >= c.probability {
+		return false, 0
+	}
+	c.corrupted.Add(1)
+	return true, c.rng.Int()
+}
+
+// truncate returns body cut short, so that it cannot be decoded: the cut
+// is inside the first field, the first resource of an export request,
+// since a cut between fields leaves a valid message with fewer resources.
+func truncate(body []byte, n int) []byte {
+	_, _, end := protowire.ConsumeField(body)
+	if end < 2 {
+		// An empty request or a broken first field: a lone tag of a
+		// length-delimited field is truncated too.
+		return protowire.AppendTag(nil, 1, protowire.BytesType)
+	}
+	return body[:1+n%(end-1)]
+}
+
+// gzipBody compresses body, flipping a byte of the compressed stream after
+// the gzip header if damage, so that decompressing it fails on the data or
+// its checksum.
+func gzipBody(body []byte, damage bool, n int) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(body)
+	w.Close()
+	compressed := buf.Bytes()
+	if damage {
+		// The 10 byte header is followed by the deflate data and an 8 byte
+		// trailer of the checksum and the size.
+		const header, trailer = 10, 8
+		compressed[header+n%(len(compressed)-header-trailer)] ^= 0xff
+	}
+	return compressed
+}
+
+// corruptCodec is the gRPC codec of the exporter with -corrupt-probability.
+// It marshals the messages with protobuf and truncates the damaged ones.
+type corruptCodec struct {
+	corrupter *corrupter
+}
+
+func (c corruptCodec) Marshal(v any) ([]byte, error) {
+	body, err := proto.Marshal(v.(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	if damage, n := c.corrupter.draw(); damage {
+		body = truncate(body, n)
+	}
+	return body, nil
+}
+
+func (corruptCodec) Unmarshal(data []byte, v any) error {
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+// Name is the name of the default codec, so the content type of the
+// requests does not change.
+func (corruptCodec) Name() string {
+	return "proto"
+}
+
+// corruptTransport damages the protobuf export requests of the HTTP
+// exporter.
+type corruptTransport struct {
+	corrupter *corrupter
+	base      http.RoundTripper
+}
+
+func (t corruptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Header.Get("Content-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	damage, n := t.corrupter.draw()
+	switch {
+	case t.corrupter.mode == corruptGzip:
+		body = gzipBody(body, damage, n)
+		req.Header.Set("Content-Encoding", "gzip")
+	case damage:
+		body = truncate(body, n)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTruncate(t *testing.T) {
+	req := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{
+		{SchemaUrl: "a"}, {SchemaUrl: "b"},
+	}}
+	body, err := proto.Marshal(req)
+	require.NoError(t, err)
+
+	for n := range 20 {
+		truncated := truncate(body, n)
+		assert.Less(t, len(truncated), len(body))
+		assert.Error(t, proto.Unmarshal(truncated, &colmetricspb.ExportMetricsServiceRequest{}), "n=%d", n)
+	}
+	assert.Error(t, proto.Unmarshal(truncate(nil, 0), &colmetricspb.ExportMetricsServiceRequest{}))
+}
+
+func TestGzipBody(t *testing.T) {
+	body := bytes.Repeat([]byte("firegen"), 100)
+	decompress := func(b []byte) ([]byte, error) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	decompressed, err := decompress(gzipBody(body, false, 0))
+	require.NoError(t, err)
+	assert.Equal(t, body, decompressed)
+	for n := range 20 {
+		_, err := decompress(gzipBody(body, true, n))
+		assert.Error(t, err, "n=%d", n)
+	}
+}
+
+func TestCorrupterDraw(t *testing.T) {
+	never := newCorrupter(corruptTruncate, 0, 1)
+	always := newCorrupter(corruptTruncate, 1, 1)
+	some := newCorrupter(corruptTruncate, 0.3, 1)
+	for range 1000 {
+		damage, _ := never.draw()
+		assert.False(t, damage)
+		damage, _ = always.draw()
+		assert.True(t, damage)
+		some.draw()
+	}
+	assert.Zero(t, never.corrupted.Load())
+	assert.EqualValues(t, 1000, always.corrupted.Load())
+	assert.InDelta(t, 300, some.corrupted.Load(), 50)
+}
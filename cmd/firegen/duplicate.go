@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math/rand"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// duplicateDataPoints repeats each data point in rm with probability p
+// right after itself, with the same attributes, timestamps and value, which
+// makes the export invalid OTLP. It returns the number of duplicates.
+func duplicateDataPoints(rm *metricdata.ResourceMetrics, p float64, rng *rand.Rand) int {
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for i, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[float64]:
+				data.DataPoints = duplicate(data.DataPoints, p, rng, &n)
+				sm.Metrics[i].Data = data
+			case metricdata.Gauge[int64]:
+				data.DataPoints = duplicate(data.DataPoints, p, rng, &n)
+				sm.Metrics[i].Data = data
+			case metricdata.Sum[float64]:
+				data.DataPoints = duplicate(data.DataPoints, p, rng, &n)
+				sm.Metrics[i].Data = data
+			case metricdata.Sum[int64]:
+				data.DataPoints = duplicate(data.DataPoints, p, rng, &n)
+				sm.Metrics[i].Data = data
+			case metricdata.Histogram[float64]:
+				data.DataPoints = duplicate(data.DataPoints, p, rng, &n)
+				sm.Metrics[i].Data = data
+			case metricdata.Histogram[int64]:
+				data.DataPoints = duplicate(data.DataPoints, p, rng, &n)
+				sm.Metrics[i].Data = data
+			}
+		}
+	}
+	return n
+}
+
+// duplicate returns dps with each data point repeated with probability p,
+// adding the number of duplicates to n. The result is a new slice, the SDK
+// reuses the one it collected into.
+func duplicate[T any](dps []T, p float64, rng *rand.Rand, n *int) []T {
+	out := make([]T, 0, len(dps))
+	for _, dp := range dps {
+		out = append(out, dp)
+		if rng.Float64() < p {
+			out = append(out, dp)
+			*n++
+		}
+	}
+	return out
+}
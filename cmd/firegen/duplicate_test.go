@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestDuplicateDataPoints(t *testing.T) {
+	now := time.Now()
+	dps := []metricdata.DataPoint[float64]{
+		{Attributes: attribute.NewSet(attribute.String("pod", "000000000")), Time: now, Value: 1},
+		{Attributes: attribute.NewSet(attribute.String("pod", "000000001")), Time: now, Value: 2},
+	}
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Metrics: []metricdata.Metrics{{
+				Name: "metric-0000",
+				Data: metricdata.Gauge[float64]{DataPoints: dps},
+			}, {
+				Name: "metric-0001",
+				Data: metricdata.Histogram[float64]{DataPoints: []metricdata.HistogramDataPoint[float64]{{Time: now, Count: 1}}},
+			}},
+		}},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	assert.Equal(t, 3, duplicateDataPoints(rm, 1, rng))
+	assert.Equal(t, []metricdata.DataPoint[float64]{dps[0], dps[0], dps[1], dps[1]},
+		rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]).DataPoints)
+	assert.Len(t, rm.ScopeMetrics[0].Metrics[1].Data.(metricdata.Histogram[float64]).DataPoints, 2)
+	assert.Equal(t, 6, countDataPoints(rm))
+
+	assert.Equal(t, 0, duplicateDataPoints(rm, 0, rng))
+	assert.Equal(t, 6, countDataPoints(rm))
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newExporter creates an exporter with a connection of its own, which its
+// shutdown closes.
+func (opts options) newExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	if opts.protocol == protocolStdout {
+		return newStdoutExporter(opts.points.rewrite), nil
+	}
+	return new(connectionPool).exporter(ctx, opts)
+}
+
+// connection is what the exporters of a connectionPool send over: a gRPC
+// client connection, an HTTP client with its transport, or a Kafka
+// producer. Each of them can send many requests at once.
+type connection struct {
+	grpc  *grpc.ClientConn
+	http  *http.Client
+	kafka *kafkaExporter
+	// users is the number of exporters sending over the connection.
+	users int
+}
+
+// dial creates a connection to the endpoint. The gRPC connection is
+// established on the first export.
+func (opts options) dial() (*connection, error) {
+	switch {
+	case opts.protocol == protocolKafka:
+		e, err := opts.newKafkaExporter()
+		if err != nil {
+			return nil, err
+		}
+		return &connection{kafka: e}, nil
+	case opts.protocol == protocolStdout:
+		return &connection{}, nil
+	case opts.useHTTP:
+		base := http.DefaultTransport.(*http.Transport).Clone()
+		base.TLSClientConfig = opts.tls
+		var transport http.RoundTripper = base
+		// The requests are damaged after they are rewritten.
+		if opts.corrupt.corrupter != nil {
+			transport = corruptTransport{corrupter: opts.corrupt.corrupter, base: transport}
+		}
+		if opts.points.rewrite != nil {
+			transport = rewriteTransport{rewriter: opts.points.rewrite, base: transport}
+		}
+		return &connection{http: &http.Client{
+			Transport: transport,
+			Timeout:   cmp.Or(opts.otlpTimeout, 10*time.Second),
+		}}, nil
+	}
+
+	creds := credentials.NewTLS(opts.tls)
+	if opts.plaintext {
+		creds = insecure.NewCredentials()
+	}
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if opts.userAgent != "" {
+		dialOpts = append(dialOpts, grpc.WithUserAgent(opts.userAgent))
+	}
+	if opts.points.rewrite != nil {
+		dialOpts = append(dialOpts, grpc.WithUnaryInterceptor(opts.points.rewrite.unaryInterceptor))
+	}
+	if opts.interceptors.chain != nil {
+		// The rewriter of WithUnaryInterceptor is prepended to the chain,
+		// so the interceptors see the rewritten requests.
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(opts.interceptors.chain.interceptors()...))
+	}
+	if opts.corrupt.corrupter != nil {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.ForceCodec(corruptCodec{opts.corrupt.corrupter})))
+	}
+	conn, err := grpc.NewClient(opts.endpoint, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &connection{grpc: conn}, nil
+}
+
+func (c *connection) close(ctx context.Context) error {
+	switch {
+	case c.grpc != nil:
+		return c.grpc.Close()
+	case c.http != nil:
+		c.http.CloseIdleConnections()
+	case c.kafka != nil:
+		return c.kafka.Shutdown(ctx)
+	}
+	return nil
+}
+
+// exporterOn creates an exporter sending over c. The OTLP exporters send
+// one request at a time, so every service, and every -export-parallelism
+// worker, has an exporter of its own, and a slow export only holds up the
+// exports of its own exporter.
+func (opts options) exporterOn(ctx context.Context, c *connection) (sdkmetric.Exporter, error) {
+	headers := make(map[string]string)
+
+	if opts.token != "" {
+		headers["authorization"] = "Bearer " + opts.token
+	} else if opts.username != "" && opts.password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(opts.username + ":" + opts.password))
+		headers["authorization"] = "Basic " + auth
+	}
+	maps.Copy(headers, opts.headers)
+
+	switch {
+	case c.kafka != nil:
+		// The producer sends concurrent exports at once.
+		return sharedProducer{c.kafka}, nil
+	case opts.protocol == protocolStdout:
+		return newStdoutExporter(opts.points.rewrite), nil
+	case c.http != nil:
+		if opts.userAgent != "" {
+			headers["User-Agent"] = opts.userAgent
+		}
+		// The client takes precedence over the TLS config and timeout
+		// options, so they are set on the client.
+		httpOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(opts.endpoint), otlpmetrichttp.WithHTTPClient(c.http)}
+		if opts.plaintext {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithInsecure())
+		}
+		if opts.urlPath != "" {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithURLPath(opts.urlPath))
+		}
+		if len(headers) > 0 {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithHeaders(headers))
+		}
+		if opts.otlpTimeout > 0 {
+			httpOpts = append(httpOpts, otlpmetrichttp.WithTimeout(opts.otlpTimeout))
+		}
+		return otlpmetrichttp.New(ctx, httpOpts...)
+	}
+
+	// The connection takes precedence over the endpoint, TLS and dial
+	// options, which dial sets on it.
+	grpcOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithGRPCConn(c.grpc)}
+	if len(headers) > 0 {
+		grpcOpts = append(grpcOpts, otlpmetricgrpc.WithHeaders(headers))
+	}
+	if opts.otlpTimeout > 0 {
+		grpcOpts = append(grpcOpts, otlpmetricgrpc.WithTimeout(opts.otlpTimeout))
+	}
+	return otlpmetricgrpc.New(ctx, grpcOpts...)
+}
+
+// sharedProducer is an exporter's use of the Kafka producer of a
+// connection, which the connection closes.
+type sharedProducer struct {
+	*kafkaExporter
+}
+
+func (p sharedProducer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// errBusy is returned by exports skipped because all -max-inflight slots
+// were taken.
+var errBusy = errors.New("all in-flight export slots are taken")
+
+// exporterInit bounds the number of services creating their exporters at
+// the same time during startup, and logs the progress. A nil exporterInit
+// is unbounded.
+type exporterInit struct {
+	slots    chan struct{}
+	services int
+	created  atomic.Int64
+}
+
+func newExporterInit(n, services int) *exporterInit {
+	return &exporterInit{slots: make(chan struct{}, n), services: services}
+}
+
+// run calls create, which creates the exporters of a service, once a slot
+// is free.
+func (e *exporterInit) run(ctx context.Context, create func() error) error {
+	if e == nil {
+		return create()
+	}
+	select {
+	case e.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	err := create()
+	<-e.slots
+	if n := int(e.created.Add(1)); n%max(1, e.services/10) == 0 || n == e.services {
+		infoLog.Printf("Created the exporters of %d/%d services", n, e.services)
+	}
+	return err
+}
+
+// inflightLimit bounds the number of exports in flight across all services.
+// A nil limit is unbounded.
+type inflightLimit struct {
+	slots chan struct{}
+	// skip makes exports that find all slots taken fail with errBusy
+	// instead of waiting for a free slot.
+	skip bool
+}
+
+func newInflightLimit(n int, skip bool) *inflightLimit {
+	return &inflightLimit{slots: make(chan struct{}, n), skip: skip}
+}
+
+// export sends rm over exporter once a slot is free. The timeout only
+// starts when the export does, not while it waits for a slot.
+func (l *inflightLimit) export(ctx context.Context, exporter sdkmetric.Exporter, rm *metricdata.ResourceMetrics, timeout time.Duration, st *stats) error {
+	if l != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if l.skip {
+				st.busy.Add(1)
+				return errBusy
+			}
+			st.blocked.Add(1)
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer func() { <-l.slots }()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return exporter.Export(ctx, rm)
+}
+
+// tlsVersions are the values of -tls-min-version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig returns the TLS configuration of the exporters for
+// -tls-min-version and -tls-cipher-suites, nil if neither is set to keep
+// the Go defaults.
+func newTLSConfig(minVersion, cipherSuites string) (*tls.Config, error) {
+	if minVersion == "" && cipherSuites == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{}
+	if minVersion != "" {
+		v, ok := tlsVersions[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q, must be 1.0, 1.1, 1.2 or 1.3", minVersion)
+		}
+		cfg.MinVersion = v
+	}
+	if cipherSuites == "" {
+		return cfg, nil
+	}
+	for name := range strings.SplitSeq(cipherSuites, ",") {
+		name = strings.TrimSpace(name)
+		i := slices.IndexFunc(tls.CipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		suite := tls.CipherSuites()[i]
+		if !slices.ContainsFunc(suite.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 }) {
+			return nil, fmt.Errorf("cipher suite %s is a TLS 1.3 suite, which Go does not allow to configure", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, suite.ID)
+	}
+	if cfg.MinVersion == tls.VersionTLS13 {
+		return nil, errors.New("cipher suites only apply to TLS 1.2 and earlier, but the minimum version is 1.3")
+	}
+	return cfg, nil
+}
+
+// forTenant returns the options for exporting the services of a tenant.
+func (opts options) forTenant(tenant tenantConfig) options {
+	if tenant.Token != "" {
+		opts.token, opts.username, opts.password = tenant.Token, "", ""
+	} else if tenant.Username != "" {
+		opts.token, opts.username, opts.password = "", tenant.Username, tenant.Password
+	}
+	opts.headers = maps.Clone(tenant.Headers)
+	return opts
+}
+
+// forTransport returns the options for exporting the services of a
+// transport.
+func (opts options) forTransport(transport transportConfig) options {
+	opts.protocol, opts.endpoint = transport.Protocol, transport.Endpoint
+	opts.useHTTP = transport.Protocol == protocolHTTP
+	return opts
+}
+
+// connectionPool is the connection shared by the services of a tenant and
+// transport, or of a -resources-per-connection group of them. The first
+// exporter creates the connection and the last one to shut down closes it.
+type connectionPool struct {
+	// members is the number of services assigned to the pool.
+	members int
+
+	mu   sync.Mutex
+	conn *connection
+	// dials is the number of connections the pool created.
+	dials int
+}
+
+// exporter returns a new exporter for a service of the pool, sending over
+// the pool's connection, which it creates with opts if there is none.
+func (p *connectionPool) exporter(ctx context.Context, opts options) (sdkmetric.Exporter, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		c, err := opts.dial()
+		if err != nil {
+			return nil, err
+		}
+		p.conn = c
+		p.dials++
+	}
+	exporter, err := opts.exporterOn(ctx, p.conn)
+	if err != nil {
+		if p.conn.users == 0 {
+			p.conn.close(ctx)
+			p.conn = nil
+		}
+		return nil, err
+	}
+	p.conn.users++
+	return &pooledExporter{Exporter: exporter, pool: p, conn: p.conn}, nil
+}
+
+// retire makes the pool create a new connection for the next exporter if
+// exporter still sends over the pool's connection, for -reconnect-after.
+// The old connection is closed once its last exporter shuts down, so the
+// other services keep exporting over it until they reconnect themselves,
+// and then move to the new connection. A nil pool has nothing to retire.
+func (p *connectionPool) retire(exporter sdkmetric.Exporter) {
+	e, ok := exporter.(*pooledExporter)
+	if p == nil || !ok {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == e.conn {
+		p.conn = nil
+	}
+}
+
+// pooledExporter is an exporter of a connectionPool, whose shutdown closes
+// its connection if no other exporter sends over it.
+type pooledExporter struct {
+	sdkmetric.Exporter
+	pool *connectionPool
+	conn *connection
+}
+
+func (e *pooledExporter) Shutdown(ctx context.Context) error {
+	err := e.Exporter.Shutdown(ctx)
+	e.pool.mu.Lock()
+	defer e.pool.mu.Unlock()
+	if e.conn.users--; e.conn.users > 0 {
+		return err
+	}
+	if e.pool.conn == e.conn {
+		e.pool.conn = nil
+	}
+	return errors.Join(err, e.conn.close(ctx))
+}
+
+// connect creates the exporter for a service. Creating an exporter does not
+// dial the endpoint, so when -startup-timeout is set connect first waits for
+// the endpoint's host to resolve, which fails while the collector's DNS
+// record does not exist yet. Failed attempts are retried with exponential
+// backoff until the startup timeout expires.
+func (opts options) connect(ctx context.Context, serviceName string) (sdkmetric.Exporter, error) {
+	newExporter := opts.newExporter
+	if opts.conn.pool != nil {
+		newExporter = func(ctx context.Context) (sdkmetric.Exporter, error) {
+			return opts.conn.pool.exporter(ctx, opts)
+		}
+	}
+	if opts.conn.startup <= 0 || opts.protocol == protocolStdout {
+		return newExporter(ctx)
+	}
+
+	deadline := time.Now().Add(opts.conn.startup)
+	backoff := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		// The Kafka brokers are a comma-separated list.
+		var err error
+		for endpoint := range strings.SplitSeq(opts.endpoint, ",") {
+			if err = resolveEndpoint(ctx, endpoint); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			var exporter sdkmetric.Exporter
+			if exporter, err = newExporter(ctx); err == nil {
+				return exporter, nil
+			}
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("giving up after %d attempts in %s: %w", attempt, opts.conn.startup, err)
+		}
+		wait := min(backoff, remaining)
+		log.Printf("Attempt %d to connect %s to %s failed, retrying in %s: %v", attempt, serviceName, opts.endpoint, wait, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, 5*time.Second)
+	}
+}
+
+// serviceExporters are the exporters of a service, one per
+// -export-parallelism worker. The OTLP exporters send one request at a
+// time, so parallel requests need exporters of their own, which send over
+// the connection of the service's pool.
+type serviceExporters struct {
+	service   string
+	exporters []sdkmetric.Exporter
+	// connect creates an exporter, opts.connect outside of tests.
+	connect func(ctx context.Context) (sdkmetric.Exporter, error)
+	pool    *connectionPool
+	limit   *inflightLimit
+	timeout time.Duration
+	st      *stats
+	// reconnect is -reconnect-after, failures counts the consecutive failed
+	// exports.
+	reconnect, failures int
+}
+
+// newServiceExporters creates the exporters of a service.
+func (opts options) newServiceExporters(serviceName string, st *stats) *serviceExporters {
+	return &serviceExporters{
+		service: serviceName,
+		connect: func(ctx context.Context) (sdkmetric.Exporter, error) {
+			return opts.connect(ctx, serviceName)
+		},
+		pool:      opts.conn.pool,
+		limit:     opts.inflight.limit,
+		timeout:   opts.timeout,
+		st:        st,
+		reconnect: opts.conn.reconnect,
+	}
+}
+
+// open creates n exporters.
+func (e *serviceExporters) open(ctx context.Context, n int) error {
+	for range n {
+		exporter, err := e.connect(ctx)
+		if err != nil {
+			return err
+		}
+		e.exporters = append(e.exporters, exporter)
+	}
+	return nil
+}
+
+// export sends each chunk in a request of its own and returns the error of
+// every chunk. Worker w sends chunks w, w+workers, ... over exporter w.
+func (e *serviceExporters) export(ctx context.Context, chunks []*metricdata.ResourceMetrics) []error {
+	workers := min(len(e.exporters), len(chunks))
+	errs := make([]error, len(chunks))
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Go(func() {
+			for c := w; c < len(chunks); c += workers {
+				errs[c] = e.limit.export(ctx, e.exporters[w], chunks[c], e.timeout, e.st)
+			}
+		})
+	}
+	wg.Wait()
+	return errs
+}
+
+// result counts the result of an export. After -reconnect-after
+// consecutive failures, the exporters are replaced with new ones over a new
+// connection of the pool.
+func (e *serviceExporters) result(ctx context.Context, err error) {
+	if err == nil {
+		e.failures = 0
+		return
+	}
+	if e.failures++; e.reconnect <= 0 || e.failures < e.reconnect {
+		return
+	}
+	e.failures = 0
+	log.Printf("Recreating OTLP exporter for %s after %d consecutive failed exports", e.service, e.reconnect)
+	for w, exporter := range e.exporters {
+		e.pool.retire(exporter)
+		exporter.Shutdown(ctx)
+		exporter, err := e.connect(ctx)
+		if err != nil {
+			log.Printf("Failed to recreate OTLP exporter for %s: %v", e.service, err)
+			return
+		}
+		e.exporters[w] = exporter
+	}
+	e.st.reconnects.Add(1)
+}
+
+// shutdown shuts down the exporters.
+func (e *serviceExporters) shutdown(ctx context.Context) {
+	for _, exporter := range e.exporters {
+		exporter.Shutdown(ctx)
+	}
+}
+
+// checkConnection sends a single data point to the endpoint, to find out
+// whether it is reachable and accepts the credentials before the services
+// start.
+func (opts options) checkConnection(ctx context.Context) error {
+	exporter, err := opts.connect(ctx, "connection check")
+	if err != nil {
+		return err
+	}
+	defer exporter.Shutdown(ctx)
+
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(semconv.ServiceNameKey.String("firegen-check")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "firegen"},
+			Metrics: []metricdata.Metrics{{
+				Name: "firegen.connection.check",
+				Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{{Time: time.Now(), Value: 1}}},
+			}},
+		}},
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	return exporter.Export(ctx, rm)
+}
+
+// resolveEndpoint looks up the host of an OTLP endpoint, which may be given
+// as host:port or as a URL.
+func resolveEndpoint(ctx context.Context, endpoint string) error {
+	host := endpoint
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+		host = u.Hostname()
+	} else if h, _, err := net.SplitHostPort(endpoint); err == nil {
+		host = h
+	}
+	if host == "" {
+		return errors.New("endpoint has no host")
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	_, err := net.DefaultResolver.LookupHost(ctx, host)
+	return err
+}
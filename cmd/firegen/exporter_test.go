@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestResolveEndpoint(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, resolveEndpoint(ctx, "127.0.0.1:4317"))
+	assert.NoError(t, resolveEndpoint(ctx, "https://127.0.0.1:4318"))
+	assert.NoError(t, resolveEndpoint(ctx, "[::1]:4317"))
+	assert.Error(t, resolveEndpoint(ctx, "https://:4318"))
+}
+
+func TestForTenant(t *testing.T) {
+	opts := options{token: "default", username: "user", password: "pass"}
+
+	tenant := opts.forTenant(tenantConfig{Token: "acme", Headers: map[string]string{"X-Scope-OrgID": "acme"}})
+	assert.Equal(t, "acme", tenant.token)
+	assert.Empty(t, tenant.username)
+	assert.Equal(t, map[string]string{"X-Scope-OrgID": "acme"}, tenant.headers)
+
+	tenant = opts.forTenant(tenantConfig{Username: "globex", Password: "secret"})
+	assert.Empty(t, tenant.token)
+	assert.Equal(t, "globex", tenant.username)
+	assert.Equal(t, "secret", tenant.password)
+
+	assert.Equal(t, opts, opts.forTenant(tenantConfig{}))
+}
+
+// blockingExporter is an exporter whose exports wait until release is
+// closed.
+type blockingExporter struct {
+	sdkmetric.Exporter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e *blockingExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.started <- struct{}{}
+	<-e.release
+	return nil
+}
+
+func TestInflightLimit(t *testing.T) {
+	ctx := context.Background()
+	exporter := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	rm := &metricdata.ResourceMetrics{}
+
+	var st stats
+	skip := newInflightLimit(1, true)
+	done := make(chan error)
+	go func() { done <- skip.export(ctx, exporter, rm, time.Second, &st) }()
+	<-exporter.started
+	assert.ErrorIs(t, skip.export(ctx, exporter, rm, time.Second, &st), errBusy)
+	assert.Equal(t, int64(1), st.busy.Load())
+	close(exporter.release)
+	assert.NoError(t, <-done)
+
+	exporter = &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	block := newInflightLimit(1, false)
+	go func() { done <- block.export(ctx, exporter, rm, time.Second, &st) }()
+	<-exporter.started
+	go func() { done <- block.export(ctx, exporter, rm, time.Second, &st) }()
+	assert.Eventually(t, func() bool { return st.blocked.Load() == 1 }, time.Second, time.Millisecond)
+	close(exporter.release)
+	<-exporter.started
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+
+	assert.NoError(t, (*inflightLimit)(nil).export(ctx, &blockingExporter{started: make(chan struct{}, 1), release: exporter.release}, rm, time.Second, &st))
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	cfg, err := newTLSConfig("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = newTLSConfig("1.3", "")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+
+	cfg, err = newTLSConfig("1.2", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, cfg.CipherSuites)
+
+	for _, test := range [][2]string{
+		{"1.4", ""},
+		{"", "TLS_MADE_UP"},
+		{"", "TLS_RSA_WITH_RC4_128_SHA"},
+		{"", "TLS_AES_128_GCM_SHA256"},
+		{"1.3", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	} {
+		_, err := newTLSConfig(test[0], test[1])
+		assert.Error(t, err, "%q", test)
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	// The server holds every request until all services are exporting at
+	// once.
+	const services = 3
+	started := make(chan struct{}, services)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	opts := options{endpoint: strings.TrimPrefix(server.URL, "http://"), useHTTP: true, plaintext: true}
+	pool := &connectionPool{}
+	opts.conn.pool = pool
+	var exporters []sdkmetric.Exporter
+	for i := range services {
+		exporter, err := opts.connect(ctx, fmt.Sprintf("service-%04d", i))
+		require.NoError(t, err)
+		assert.Same(t, pool.conn, exporter.(*pooledExporter).conn)
+		exporters = append(exporters, exporter)
+	}
+	assert.Equal(t, 1, pool.dials)
+	assert.Equal(t, services, pool.conn.users)
+
+	// The exports of the services do not wait for each other.
+	var wg sync.WaitGroup
+	for _, exporter := range exporters {
+		wg.Go(func() {
+			assert.NoError(t, exporter.Export(ctx, &metricdata.ResourceMetrics{Resource: resource.Empty()}))
+		})
+	}
+	for range services {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the exports of the pool are sent one at a time")
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	// A reconnecting service moves to a new connection, the others keep
+	// the old one until they reconnect too.
+	first := pool.conn
+	pool.retire(exporters[0])
+	assert.NoError(t, exporters[0].Shutdown(ctx))
+	reconnected, err := opts.connect(ctx, "service-0000")
+	require.NoError(t, err)
+	assert.Equal(t, 2, pool.dials)
+	assert.NotSame(t, first, reconnected.(*pooledExporter).conn)
+	assert.Equal(t, services-1, first.users)
+	pool.retire(exporters[1])
+	assert.NoError(t, exporters[1].Shutdown(ctx))
+	moved, err := opts.connect(ctx, "service-0001")
+	require.NoError(t, err)
+	assert.Equal(t, 2, pool.dials)
+	assert.Same(t, reconnected.(*pooledExporter).conn, moved.(*pooledExporter).conn)
+
+	for _, exporter := range []sdkmetric.Exporter{exporters[2], reconnected, moved} {
+		assert.NoError(t, exporter.Shutdown(ctx))
+	}
+	assert.Zero(t, first.users)
+	assert.Nil(t, pool.conn)
+}
+
+func TestConnectionPoolGRPC(t *testing.T) {
+	ctx := context.Background()
+	opts := options{endpoint: "127.0.0.1:4317", plaintext: true}
+	pool := &connectionPool{}
+	a, err := pool.exporter(ctx, opts)
+	require.NoError(t, err)
+	b, err := pool.exporter(ctx, opts)
+	require.NoError(t, err)
+	conn := pool.conn.grpc
+	require.NotNil(t, conn)
+	assert.NotSame(t, a.(*pooledExporter).Exporter, b.(*pooledExporter).Exporter)
+
+	assert.NoError(t, a.Shutdown(ctx))
+	assert.NotEqual(t, connectivity.Shutdown, conn.GetState())
+	assert.NoError(t, b.Shutdown(ctx))
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+	assert.Nil(t, pool.conn)
+}
+
+func TestExporterInit(t *testing.T) {
+	ctx := context.Background()
+	init := newExporterInit(2, 4)
+	release := make(chan struct{})
+	var running atomic.Int64
+	done := make(chan error)
+	for range 4 {
+		go func() {
+			done <- init.run(ctx, func() error {
+				running.Add(1)
+				<-release
+				running.Add(-1)
+				return nil
+			})
+		}()
+	}
+	assert.Eventually(t, func() bool { return running.Load() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int64(2), running.Load())
+	close(release)
+	for range 4 {
+		assert.NoError(t, <-done)
+	}
+	assert.Equal(t, int64(4), init.created.Load())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	full := newExporterInit(1, 1)
+	full.slots <- struct{}{}
+	assert.ErrorIs(t, full.run(canceled, func() error { return nil }), context.Canceled)
+	assert.NoError(t, (*exporterInit)(nil).run(ctx, func() error { return nil }))
+}
+
+// recordingExporter records its exports and fails them with err.
+type recordingExporter struct {
+	sdkmetric.Exporter
+	err      error
+	mu       sync.Mutex
+	exports  []*metricdata.ResourceMetrics
+	shutdown bool
+}
+
+func (e *recordingExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.exports = append(e.exports, rm)
+	return e.err
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	e.shutdown = true
+	return nil
+}
+
+func TestServiceExportersReconnect(t *testing.T) {
+	ctx := context.Background()
+	var st stats
+	var created []*recordingExporter
+	exporters := &serviceExporters{
+		service: "service-0000",
+		connect: func(ctx context.Context) (sdkmetric.Exporter, error) {
+			e := &recordingExporter{}
+			created = append(created, e)
+			return e, nil
+		},
+		timeout:   time.Second,
+		st:        &st,
+		reconnect: 3,
+	}
+	require.NoError(t, exporters.open(ctx, 2))
+	require.Len(t, created, 2)
+
+	failed := errors.New("unavailable")
+	exporters.result(ctx, failed)
+	exporters.result(ctx, failed)
+	exporters.result(ctx, nil)
+	exporters.result(ctx, failed)
+	exporters.result(ctx, failed)
+	assert.Len(t, created, 2, "a success resets the consecutive failures")
+	assert.Zero(t, st.reconnects.Load())
+
+	exporters.result(ctx, failed)
+	require.Len(t, created, 4)
+	assert.True(t, created[0].shutdown)
+	assert.True(t, created[1].shutdown)
+	assert.Equal(t, []sdkmetric.Exporter{created[2], created[3]}, exporters.exporters)
+	assert.Equal(t, int64(1), st.reconnects.Load())
+
+	// The count starts over with the new exporters.
+	exporters.result(ctx, failed)
+	exporters.result(ctx, failed)
+	assert.Len(t, created, 4)
+	exporters.result(ctx, failed)
+	assert.Len(t, created, 6)
+	assert.Equal(t, int64(2), st.reconnects.Load())
+
+	exporters.shutdown(ctx)
+	assert.True(t, created[4].shutdown)
+	assert.True(t, created[5].shutdown)
+}
+
+func TestServiceExportersParallel(t *testing.T) {
+	ctx := context.Background()
+	var gauge metricdata.Gauge[float64]
+	for v := range 10 {
+		gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{Value: float64(v)})
+	}
+	rm := &metricdata.ResourceMetrics{
+		Resource:     resource.Empty(),
+		ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{{Name: "gauge", Data: gauge}}}},
+	}
+	opts := options{maxPoints: 3}
+	chunks := opts.splitExport(rm)
+	require.Len(t, chunks, 4)
+
+	var st stats
+	var created []*recordingExporter
+	exporters := &serviceExporters{
+		connect: func(ctx context.Context) (sdkmetric.Exporter, error) {
+			e := &recordingExporter{}
+			created = append(created, e)
+			return e, nil
+		},
+		timeout: time.Second,
+		st:      &st,
+	}
+	require.NoError(t, exporters.open(ctx, 3))
+	assert.Equal(t, make([]error, 4), exporters.export(ctx, chunks))
+
+	// Worker w sends chunks w, w+3, ... over exporter w.
+	assert.Equal(t, []*metricdata.ResourceMetrics{chunks[0], chunks[3]}, created[0].exports)
+	assert.Equal(t, []*metricdata.ResourceMetrics{chunks[1]}, created[1].exports)
+	assert.Equal(t, []*metricdata.ResourceMetrics{chunks[2]}, created[2].exports)
+	var values []float64
+	for _, e := range created {
+		for _, chunk := range e.exports {
+			for _, dp := range chunk.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]).DataPoints {
+				values = append(values, dp.Value)
+			}
+		}
+	}
+	assert.ElementsMatch(t, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values)
+
+	// More exporters than chunks leave the rest idle.
+	created[0].exports = nil
+	created[0].err = errors.New("unavailable")
+	errs := exporters.export(ctx, splitResourceMetrics(rm, 0))
+	assert.Equal(t, []error{created[0].err}, errs)
+	assert.Len(t, created[0].exports, 1)
+	assert.Len(t, created[1].exports, 1)
+}
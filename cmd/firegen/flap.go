@@ -0,0 +1,54 @@
+package main
+
+import (
+	randv2 "math/rand/v2"
+	"time"
+)
+
+// flapStream is the PCG stream of the flap schedules, apart from the
+// streams of -metric-order, which are the service indexes.
+const flapStream = 1 << 32
+
+// flapper is the schedule of a service flapping with -flap-fraction. The
+// service alternates between up and down phases, starting up, each lasting
+// a random duration between half and one and a half -flap-period.
+type flapper struct {
+	period time.Duration
+	rng    *randv2.Rand
+	down   bool
+	// until is the end of the current phase and since the tick that saw the
+	// current state first.
+	until, since time.Time
+}
+
+// newFlapper returns the schedule of the service with index, starting up at
+// start. The same seed and index reproduce the same schedule.
+func newFlapper(period time.Duration, seed int64, index int, start time.Time) *flapper {
+	f := &flapper{
+		period: period,
+		rng:    randv2.New(randv2.NewPCG(uint64(seed), flapStream+uint64(index))),
+		since:  start,
+	}
+	f.until = start.Add(f.phase())
+	return f
+}
+
+func (f *flapper) phase() time.Duration {
+	return f.period/2 + time.Duration(f.rng.Int64N(int64(f.period)))
+}
+
+// at advances the schedule to now and reports whether the service is down,
+// whether that changed since the last call and how long the previous state
+// lasted. Phases shorter than the time between calls may go unnoticed.
+func (f *flapper) at(now time.Time) (down, changed bool, lasted time.Duration) {
+	was := f.down
+	for !now.Before(f.until) {
+		f.down = !f.down
+		f.until = f.until.Add(f.phase())
+	}
+	if f.down == was {
+		return f.down, false, 0
+	}
+	lasted, f.since = now.Sub(f.since), now
+	return f.down, true, lasted
+}
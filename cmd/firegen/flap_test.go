@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlapper(t *testing.T) {
+	start := time.Unix(0, 0)
+	schedule := func(f *flapper) []bool {
+		var states []bool
+		for s := range 600 {
+			down, _, _ := f.at(start.Add(time.Duration(s) * time.Second))
+			states = append(states, down)
+		}
+		return states
+	}
+
+	f := newFlapper(time.Minute, 1, 0, start)
+	transitions, down := 0, 0
+	phase := start
+	for s := range 600 {
+		now := start.Add(time.Duration(s) * time.Second)
+		isDown, changed, lasted := f.at(now)
+		if s == 0 {
+			assert.False(t, isDown, "starts up")
+		}
+		if changed {
+			transitions++
+			assert.Equal(t, now.Sub(phase), lasted)
+			assert.GreaterOrEqual(t, lasted, 30*time.Second)
+			assert.LessOrEqual(t, lasted, 90*time.Second)
+			phase = now
+		}
+		if isDown {
+			down++
+		}
+	}
+	assert.GreaterOrEqual(t, transitions, 6)
+	assert.InDelta(t, 300, down, 120)
+
+	assert.Equal(t, schedule(newFlapper(time.Minute, 1, 0, start)), schedule(newFlapper(time.Minute, 1, 0, start)))
+	assert.NotEqual(t, schedule(newFlapper(time.Minute, 1, 0, start)), schedule(newFlapper(time.Minute, 1, 1, start)))
+}
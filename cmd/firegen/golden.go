@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// goldenVersion is the version of the -golden dataset. Any change to the
+// dataset, however small, must increment it, so test suites can tell which
+// dataset they received.
+const goldenVersion = 1
+
+// goldenVersionKey is the resource attribute carrying goldenVersion.
+const goldenVersionKey = attribute.Key("firegen.golden.version")
+
+// goldenMetrics returns the -golden dataset, the same on every run except
+// for its timestamps: every data point is taken at now and cumulative ones
+// start a minute earlier. The README documents the dataset.
+func goldenMetrics(now time.Time) *metricdata.ResourceMetrics {
+	start := now.Add(-time.Minute)
+	return &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(
+			semconv.ServiceNameKey.String("firegen-golden"),
+			goldenVersionKey.Int(goldenVersion),
+		),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "firegen-golden", Version: strconv.Itoa(goldenVersion)},
+			Metrics: []metricdata.Metrics{
+				{
+					Name:        "firegen.golden.gauge",
+					Description: "A float gauge with two series",
+					Unit:        "1",
+					Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{
+						{Attributes: attribute.NewSet(attribute.String("region", "eu-west")), Time: now, Value: -2.25},
+						{Attributes: attribute.NewSet(attribute.String("region", "us-east")), Time: now, Value: 1.5},
+					}},
+				},
+				{
+					Name:        "firegen.golden.int_gauge",
+					Description: "An integer gauge without attributes",
+					Unit:        "By",
+					Data: metricdata.Gauge[int64]{DataPoints: []metricdata.DataPoint[int64]{
+						{Time: now, Value: 1048576},
+					}},
+				},
+				{
+					Name:        "firegen.golden.counter",
+					Description: "A monotonic cumulative sum with two series",
+					Unit:        "{request}",
+					Data: metricdata.Sum[float64]{
+						Temporality: metricdata.CumulativeTemporality,
+						IsMonotonic: true,
+						DataPoints: []metricdata.DataPoint[float64]{
+							{Attributes: attribute.NewSet(attribute.String("status", "error")), StartTime: start, Time: now, Value: 7},
+							{Attributes: attribute.NewSet(attribute.String("status", "ok")), StartTime: start, Time: now, Value: 100},
+						},
+					},
+				},
+				{
+					Name:        "firegen.golden.updowncounter",
+					Description: "A non-monotonic cumulative sum with a negative value",
+					Unit:        "{item}",
+					Data: metricdata.Sum[int64]{
+						Temporality: metricdata.CumulativeTemporality,
+						DataPoints: []metricdata.DataPoint[int64]{
+							{Attributes: attribute.NewSet(attribute.String("queue", "a"), attribute.Bool("priority", true)), StartTime: start, Time: now, Value: -3},
+						},
+					},
+				},
+				{
+					Name:        "firegen.golden.histogram",
+					Description: "A cumulative explicit bucket histogram with min and max",
+					Unit:        "ms",
+					Data: metricdata.Histogram[float64]{
+						Temporality: metricdata.CumulativeTemporality,
+						DataPoints: []metricdata.HistogramDataPoint[float64]{{
+							Attributes:   attribute.NewSet(attribute.String("route", "/checkout")),
+							StartTime:    start,
+							Time:         now,
+							Count:        7,
+							Sum:          3461.5,
+							Bounds:       []float64{10, 100, 1000},
+							BucketCounts: []uint64{1, 2, 3, 1},
+							Min:          metricdata.NewExtrema(5.0),
+							Max:          metricdata.NewExtrema(2000.0),
+						}},
+					},
+				},
+			},
+		}},
+	}
+}
+
+// sendGolden exports the -golden dataset once.
+func sendGolden(ctx context.Context, opts options) (*metricdata.ResourceMetrics, error) {
+	exporter, err := opts.connect(ctx, "golden")
+	if err != nil {
+		return nil, err
+	}
+	defer exporter.Shutdown(ctx)
+
+	rm := goldenMetrics(time.Now())
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	return rm, exporter.Export(ctx, rm)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestGoldenMetrics(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rm := goldenMetrics(now)
+	assert.Equal(t, goldenMetrics(now), rm)
+	assert.Equal(t, 7, countDataPoints(rm))
+
+	version, ok := rm.Resource.Set().Value(goldenVersionKey)
+	require.True(t, ok)
+	assert.Equal(t, int64(goldenVersion), version.AsInt64())
+
+	var names []string
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{
+		"firegen.golden.gauge",
+		"firegen.golden.int_gauge",
+		"firegen.golden.counter",
+		"firegen.golden.updowncounter",
+		"firegen.golden.histogram",
+	}, names)
+
+	dp := rm.ScopeMetrics[0].Metrics[4].Data.(metricdata.Histogram[float64]).DataPoints[0]
+	var count uint64
+	for _, n := range dp.BucketCounts {
+		count += n
+	}
+	assert.Equal(t, dp.Count, count)
+	assert.Len(t, dp.BucketCounts, len(dp.Bounds)+1)
+
+	_, err := toMetricsData(rm)
+	assert.NoError(t, err)
+}
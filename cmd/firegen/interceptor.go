@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Built-in interceptors of -grpc-interceptors.
+const (
+	// interceptorMetadata adds a unique x-request-id and a W3C traceparent
+	// to the metadata of every call, like auth and tracing middleware.
+	interceptorMetadata = "metadata"
+	// interceptorLog logs every call with its status, duration and request
+	// size.
+	interceptorLog = "log"
+	// interceptorFail fails calls with -grpc-fail-probability before they
+	// are sent, with a retryable Unavailable status.
+	interceptorFail = "fail"
+)
+
+// interceptorChain is the chain of built-in unary interceptors of the gRPC
+// exporters, shared by all of them. It is safe for concurrent use.
+type interceptorChain struct {
+	names       []string
+	probability float64
+	calls       atomic.Int64
+	failed      atomic.Int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// parseInterceptors parses the comma-separated -grpc-interceptors, in the
+// order they are chained, the first one outermost.
+func parseInterceptors(s string) ([]string, error) {
+	var names []string
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case interceptorMetadata, interceptorLog, interceptorFail:
+		default:
+			return nil, fmt.Errorf("unknown interceptor %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func newInterceptorChain(names []string, probability float64, seed int64) *interceptorChain {
+	return &interceptorChain{names: names, probability: probability, rng: rand.New(rand.NewSource(seed))}
+}
+
+// interceptors returns the unary interceptors of the chain, for
+// grpc.WithChainUnaryInterceptor.
+func (c *interceptorChain) interceptors() []grpc.UnaryClientInterceptor {
+	interceptors := []grpc.UnaryClientInterceptor{c.count}
+	for _, name := range c.names {
+		switch name {
+		case interceptorMetadata:
+			interceptors = append(interceptors, c.metadata)
+		case interceptorLog:
+			interceptors = append(interceptors, c.log)
+		case interceptorFail:
+			interceptors = append(interceptors, c.fail)
+		}
+	}
+	return interceptors
+}
+
+func (c *interceptorChain) count(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c.calls.Add(1)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (c *interceptorChain) metadata(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	requestID := fmt.Sprintf("%016x", c.rng.Uint64())
+	traceparent := fmt.Sprintf("00-%016x%016x-%016x-01", c.rng.Uint64(), c.rng.Uint64(), c.rng.Uint64())
+	c.mu.Unlock()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", requestID, "traceparent", traceparent)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (c *interceptorChain) log(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	t := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	size := 0
+	if m, ok := req.(proto.Message); ok {
+		size = proto.Size(m)
+	}
+	infoLog.Printf("gRPC call %s to %s: %s in %dms, %d bytes", method, cc.Target(), status.Code(err), time.Since(t).Milliseconds(), size)
+	return err
+}
+
+func (c *interceptorChain) fail(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	c.mu.Lock()
+	fail := c.rng.Float64() < c.probability
+	c.mu.Unlock()
+	if fail {
+		c.failed.Add(1)
+		return status.Error(codes.Unavailable, "firegen: injected failure of the fail interceptor")
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseInterceptors(t *testing.T) {
+	names, err := parseInterceptors("log, metadata,fail")
+	require.NoError(t, err)
+	assert.Equal(t, []string{interceptorLog, interceptorMetadata, interceptorFail}, names)
+	_, err = parseInterceptors("log,retry")
+	assert.Error(t, err)
+}
+
+func TestInterceptorChain(t *testing.T) {
+	cc, err := grpc.NewClient("passthrough:///collector", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer cc.Close()
+	call := func(chain *interceptorChain) (metadata.MD, bool, error) {
+		var md metadata.MD
+		invoked := false
+		invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ = metadata.FromOutgoingContext(ctx)
+			invoked = true
+			return nil
+		}
+		// Chain the interceptors like grpc.WithChainUnaryInterceptor, the
+		// first one outermost.
+		interceptors := chain.interceptors()
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			next, interceptor := invoker, interceptors[i]
+			invoker = func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return interceptor(ctx, method, req, reply, cc, next, opts...)
+			}
+		}
+		err := invoker(context.Background(), "/Export", nil, nil, cc)
+		return md, invoked, err
+	}
+
+	md, invoked, err := call(newInterceptorChain([]string{interceptorMetadata, interceptorLog}, 0, 1))
+	require.NoError(t, err)
+	assert.True(t, invoked)
+	require.Len(t, md.Get("x-request-id"), 1)
+	assert.Len(t, md.Get("x-request-id")[0], 16)
+	require.Len(t, md.Get("traceparent"), 1)
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, md.Get("traceparent")[0])
+
+	fail := newInterceptorChain([]string{interceptorFail}, 1, 1)
+	_, invoked, err = call(fail)
+	assert.False(t, invoked)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.EqualValues(t, 1, fail.calls.Load())
+	assert.EqualValues(t, 1, fail.failed.Load())
+
+	never := newInterceptorChain([]string{interceptorFail}, 0, 1)
+	_, invoked, err = call(never)
+	assert.True(t, invoked)
+	assert.NoError(t, err)
+	assert.Zero(t, never.failed.Load())
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// jitteredCount returns the number of series a service with the given
+// -cardinality-jitter scale generates of n configured ones, at least one.
+// A zero scale keeps n.
+func jitteredCount(n int, scale float64) int {
+	if scale == 0 {
+		return n
+	}
+	return max(1, int(math.Round(float64(n)*scale)))
+}
+
+// jitteredAttributes returns the attribute combinations of a service with
+// the given -cardinality-jitter scale: the first jitteredCount combinations
+// yielded by iterateAttributes, with the cardinality of the first attribute
+// without a paretoAlpha raised as far as needed to yield more than
+// configured.
+func jitteredAttributes(attrConfigs []attributeConfig, scale float64, mode string, svc service) [][]attribute.KeyValue {
+	if scale == 0 || len(attrConfigs) == 0 {
+		return slices.Collect(iterateAttributes(attrConfigs, mode, svc))
+	}
+	total := cardinality(attrConfigs)
+	n := jitteredCount(total, scale)
+	configs := slices.Clone(attrConfigs)
+	if f := slices.IndexFunc(configs, func(a attributeConfig) bool { return !a.pareto() }); f >= 0 {
+		rest := total / configs[f].Cardinality
+		configs[f].Cardinality = max(configs[f].Cardinality, (n+rest-1)/rest)
+	}
+	return slices.Collect(iterateAttributes(configs, mode, svc))[:n]
+}
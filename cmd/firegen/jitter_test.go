@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitteredAttributes(t *testing.T) {
+	attrConfigs := []attributeConfig{{Name: "region", Cardinality: 2}, {Name: "pod", Cardinality: 5}}
+	svc := service{0, "service-0000"}
+	all := jitteredAttributes(attrConfigs, 0, valuesShared, svc)
+	assert.Len(t, all, 10)
+
+	fewer := jitteredAttributes(attrConfigs, 0.8, valuesShared, svc)
+	assert.Equal(t, all[:8], fewer)
+
+	more := jitteredAttributes(attrConfigs, 1.2, valuesShared, svc)
+	assert.Len(t, more, 12)
+	assert.Equal(t, all, more[:10])
+	assert.Equal(t, "000000002", more[10][0].Value.AsString())
+
+	assert.Len(t, jitteredAttributes(attrConfigs, 0.01, valuesShared, svc), 1)
+	assert.Equal(t, 8, jitteredCount(10, 0.8))
+	assert.Equal(t, 10, jitteredCount(10, 0))
+}
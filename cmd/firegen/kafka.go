@@ -0,0 +1,159 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protocols the exporters can send with.
+const (
+	protocolGRPC  = "grpc"
+	protocolHTTP  = "http"
+	protocolKafka = "kafka"
+	// protocolStdout prints the exports instead of sending them.
+	protocolStdout = "stdout"
+)
+
+// SASL mechanisms of -kafka-sasl-mechanism.
+const (
+	saslPlain       = "plain"
+	saslSCRAMSHA256 = "scram-sha-256"
+	saslSCRAMSHA512 = "scram-sha-512"
+	saslOAuthBearer = "oauthbearer"
+)
+
+// kafkaExporter produces every export as an OTLP protobuf
+// ExportMetricsServiceRequest to a Kafka topic, the format of the
+// collector's Kafka receiver with the otlp_proto encoding. The records are
+// keyed by service name, so all exports of a service go to one partition.
+type kafkaExporter struct {
+	client  *kgo.Client
+	topic   string
+	headers []kgo.RecordHeader
+	rewrite *rewriter
+}
+
+// newKafkaExporter creates a producer for the brokers in opts.endpoint. The
+// credentials select the SASL mechanism like the OTLP authentication: a
+// token authenticates with OAUTHBEARER, a username and password with PLAIN
+// unless -kafka-sasl-mechanism selects SCRAM. The headers become record
+// headers. Unless -plaintext, the brokers are connected with TLS.
+func (opts options) newKafkaExporter() (*kafkaExporter, error) {
+	kafkaOpts := []kgo.Opt{
+		kgo.SeedBrokers(strings.Split(opts.endpoint, ",")...),
+		kgo.DefaultProduceTopic(opts.kafka.topic),
+		kgo.ClientID("firegen"),
+		kgo.SoftwareNameAndVersion("firegen", strings.TrimPrefix(version(), "v")),
+	}
+	if !opts.plaintext {
+		kafkaOpts = append(kafkaOpts, kgo.DialTLSConfig(tlsOrDefault(opts.tls)))
+	}
+	mechanism, err := opts.saslMechanism()
+	if err != nil {
+		return nil, err
+	} else if mechanism != nil {
+		kafkaOpts = append(kafkaOpts, kgo.SASL(mechanism))
+	}
+	client, err := kgo.NewClient(kafkaOpts...)
+	if err != nil {
+		return nil, err
+	}
+	e := &kafkaExporter{client: client, topic: opts.kafka.topic, rewrite: opts.points.rewrite}
+	for _, key := range slices.Sorted(maps.Keys(opts.headers)) {
+		e.headers = append(e.headers, kgo.RecordHeader{Key: key, Value: []byte(opts.headers[key])})
+	}
+	return e, nil
+}
+
+// tlsOrDefault returns a copy of c, or an empty config for the default TLS
+// settings.
+func tlsOrDefault(c *tls.Config) *tls.Config {
+	if c == nil {
+		return &tls.Config{}
+	}
+	return c.Clone()
+}
+
+func (opts options) saslMechanism() (sasl.Mechanism, error) {
+	switch {
+	case opts.kafka.sasl == "" && opts.token != "", opts.kafka.sasl == saslOAuthBearer:
+		if opts.token == "" {
+			return nil, fmt.Errorf("SASL mechanism %s requires a token", saslOAuthBearer)
+		}
+		return oauth.Auth{Token: opts.token}.AsMechanism(), nil
+	case opts.kafka.sasl == "" && opts.username == "":
+		return nil, nil
+	}
+	if opts.username == "" || opts.password == "" {
+		return nil, fmt.Errorf("SASL mechanism %s requires a username and password", cmp.Or(opts.kafka.sasl, saslPlain))
+	}
+	switch opts.kafka.sasl {
+	case "", saslPlain:
+		return plain.Auth{User: opts.username, Pass: opts.password}.AsMechanism(), nil
+	case saslSCRAMSHA256:
+		return scram.Auth{User: opts.username, Pass: opts.password}.AsSha256Mechanism(), nil
+	case saslSCRAMSHA512:
+		return scram.Auth{User: opts.username, Pass: opts.password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unknown SASL mechanism %q", opts.kafka.sasl)
+	}
+}
+
+func (e *kafkaExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *kafkaExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export produces rm as one record and waits until the brokers acknowledged
+// it.
+func (e *kafkaExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	pb, err := toMetricsData(rm)
+	if err != nil {
+		return err
+	}
+	e.rewrite.apply(pb.ResourceMetrics)
+	value, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: pb.ResourceMetrics})
+	if err != nil {
+		return err
+	}
+	serviceName, _ := rm.Resource.Set().Value(semconv.ServiceNameKey)
+	record := &kgo.Record{
+		Topic:   e.topic,
+		Key:     []byte(serviceName.AsString()),
+		Value:   value,
+		Headers: e.headers,
+	}
+	err = e.client.ProduceSync(ctx, record).FirstErr()
+	if e.rewrite != nil && e.rewrite.ramp != nil {
+		e.rewrite.ramp.record(len(value), err)
+	}
+	return err
+}
+
+func (e *kafkaExporter) ForceFlush(ctx context.Context) error {
+	return e.client.Flush(ctx)
+}
+
+func (e *kafkaExporter) Shutdown(ctx context.Context) error {
+	e.client.Close()
+	return nil
+}
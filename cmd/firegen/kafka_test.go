@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestSASLMechanism(t *testing.T) {
+	for _, test := range []struct {
+		opts options
+		want string
+	}{
+		{options{}, ""},
+		{options{token: "secret"}, "OAUTHBEARER"},
+		{options{username: "user", password: "pass"}, "PLAIN"},
+		{options{username: "user", password: "pass", kafka: kafkaOptions{sasl: saslSCRAMSHA256}}, "SCRAM-SHA-256"},
+		{options{username: "user", password: "pass", kafka: kafkaOptions{sasl: saslSCRAMSHA512}}, "SCRAM-SHA-512"},
+		{options{token: "secret", username: "user", password: "pass", kafka: kafkaOptions{sasl: saslPlain}}, "PLAIN"},
+	} {
+		mechanism, err := test.opts.saslMechanism()
+		require.NoError(t, err)
+		if test.want == "" {
+			assert.Nil(t, mechanism)
+		} else {
+			assert.Equal(t, test.want, mechanism.Name())
+		}
+	}
+
+	for _, opts := range []options{
+		{kafka: kafkaOptions{sasl: saslOAuthBearer}},
+		{kafka: kafkaOptions{sasl: saslSCRAMSHA256}, username: "user"},
+		{kafka: kafkaOptions{sasl: "gssapi"}, username: "user", password: "pass"},
+	} {
+		_, err := opts.saslMechanism()
+		assert.Error(t, err, "%+v", opts)
+	}
+}
+
+func TestNewKafkaExporter(t *testing.T) {
+	opts := options{
+		protocol:  protocolKafka,
+		endpoint:  "localhost:9092,localhost:9093",
+		kafka:     kafkaOptions{topic: "otlp_metrics"},
+		plaintext: true,
+		headers:   map[string]string{"tenant": "acme", "env": "test"},
+	}
+	e, err := opts.newKafkaExporter()
+	require.NoError(t, err)
+	defer e.client.Close()
+	assert.Equal(t, []kgo.RecordHeader{
+		{Key: "env", Value: []byte("test")},
+		{Key: "tenant", Value: []byte("acme")},
+	}, e.headers)
+	assert.Equal(t, []string{"localhost:9092", "localhost:9093"}, e.client.OptValue(kgo.SeedBrokers))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// cardinalityLimitEnv is the environment variable of the SDK's experimental
+// cardinality limit. The limit applies to every instrument of the meter
+// providers created after it is set.
+const cardinalityLimitEnv = "OTEL_GO_X_CARDINALITY_LIMIT"
+
+// setCardinalityLimit caps the series of every instrument at limit. The SDK
+// v1.37 has no provider, reader or view option for the limit, it only reads
+// the environment when an instrument aggregates its first measurement, so
+// main sets it once right after validating the flags, before any meter
+// provider exists, and it never changes after. Tests set it with t.Setenv.
+func setCardinalityLimit(limit int) {
+	os.Setenv(cardinalityLimitEnv, strconv.Itoa(limit))
+}
+
+// overflowKey is the attribute of the series an instrument over the
+// cardinality limit aggregates the measurements of any further series in.
+const overflowKey = attribute.Key("otel.metric.overflow")
+
+// overflowMetrics returns the number of metrics in rm that hit the
+// cardinality limit, those with an overflow series.
+func overflowMetrics(rm *metricdata.ResourceMetrics) int {
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			var overflow bool
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[float64]:
+				overflow = slices.ContainsFunc(data.DataPoints, func(dp metricdata.DataPoint[float64]) bool { return dp.Attributes.HasValue(overflowKey) })
+			case metricdata.Gauge[int64]:
+				overflow = slices.ContainsFunc(data.DataPoints, func(dp metricdata.DataPoint[int64]) bool { return dp.Attributes.HasValue(overflowKey) })
+			case metricdata.Sum[float64]:
+				overflow = slices.ContainsFunc(data.DataPoints, func(dp metricdata.DataPoint[float64]) bool { return dp.Attributes.HasValue(overflowKey) })
+			case metricdata.Sum[int64]:
+				overflow = slices.ContainsFunc(data.DataPoints, func(dp metricdata.DataPoint[int64]) bool { return dp.Attributes.HasValue(overflowKey) })
+			case metricdata.Histogram[float64]:
+				overflow = slices.ContainsFunc(data.DataPoints, func(dp metricdata.HistogramDataPoint[float64]) bool { return dp.Attributes.HasValue(overflowKey) })
+			case metricdata.Histogram[int64]:
+				overflow = slices.ContainsFunc(data.DataPoints, func(dp metricdata.HistogramDataPoint[int64]) bool { return dp.Attributes.HasValue(overflowKey) })
+			}
+			if overflow {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestOverflowMetrics(t *testing.T) {
+	t.Setenv(cardinalityLimitEnv, "3")
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(temporality))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	limited, err := newInstrument(provider.Meter("test"), metricConfig{Name: "limited", metricOptions: metricOptions{Type: metricCounter}})
+	require.NoError(t, err)
+	unlimited, err := newInstrument(provider.Meter("test"), metricConfig{Name: "unlimited", metricOptions: metricOptions{Type: metricCounter}})
+	require.NoError(t, err)
+
+	for i := range 5 {
+		limited(ctx, 1, metric.WithAttributes(attribute.String("pod", fmt.Sprint(i))))
+	}
+	unlimited(ctx, 1, metric.WithAttributes(attribute.String("pod", "a")))
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	assert.Equal(t, 1, overflowMetrics(&rm))
+	assert.Equal(t, 4, countDataPoints(&rm))
+}
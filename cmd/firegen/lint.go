@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// metricOption is a metric option the linter knows when it is unused.
+type metricOption struct {
+	name string
+	set  func(metricOptions) bool
+	// unused returns why the option has no effect on a metric with the
+	// resolved options o, or "" if it has.
+	unused func(o metricOptions) string
+}
+
+var metricOptionUses = []metricOption{
+	{"min", func(o metricOptions) bool { return o.Min != nil }, boundsUnused},
+	{"max", func(o metricOptions) bool { return o.Max != nil }, boundsUnused},
+	{"step", func(o metricOptions) bool { return o.Step != nil }, func(o metricOptions) string {
+		if o.Pattern != patternRandomWalk {
+			return "only random walks take steps, set pattern " + patternRandomWalk
+		}
+		return ""
+	}},
+	{"precision", func(o metricOptions) bool { return o.Precision != nil }, func(o metricOptions) string {
+		if o.BucketCounts != nil {
+			return "bucketCounts record the bucket boundaries unrounded"
+		}
+		return ""
+	}},
+}
+
+// boundsUnused returns why min and max have no effect on a metric.
+func boundsUnused(o metricOptions) string {
+	switch {
+	case o.Pattern == patternTimestamp:
+		return "pattern " + patternTimestamp + " records the time"
+	case o.Rate != nil:
+		return "rate sets the increase"
+	case o.BucketCounts != nil:
+		return "bucketCounts decide the observations"
+	case o.Expr != "":
+		return "expr computes the values"
+	case o.Distribution != nil:
+		return "the distribution draws the values unbounded"
+	}
+	return ""
+}
+
+// lintConfig reports settings of a valid config that are unreachable or
+// redundant: options that have no effect on any metric and values that
+// make an option pointless. Settings the -detect-resources attributes
+// could satisfy are not reported with detect.
+func lintConfig(cfg config, detect bool) []string {
+	var issues []string
+	report := func(format string, args ...any) {
+		issues = append(issues, fmt.Sprintf(format, args...))
+	}
+
+	if len(cfg.Metrics.Definitions) == 0 {
+		lintMetricOptions("metrics", cfg.metricOptions, cfg.metricOptions, report)
+	} else {
+		for _, opt := range metricOptionUses {
+			if !opt.set(cfg.metricOptions) {
+				continue
+			}
+			used := false
+			for _, m := range cfg.Metrics.Definitions {
+				inherited := m.Type == "" || m.Type == cmp.Or(cfg.Type, metricGauge)
+				if inherited && !opt.set(m.metricOptions) && opt.unused(m.withDefaults(cfg.metricOptions)) == "" {
+					used = true
+				}
+			}
+			if !used {
+				report("top-level %s has no effect on any metric", opt.name)
+			}
+		}
+		for _, m := range cfg.Metrics.Definitions {
+			lintMetricOptions("metric "+m.Name, m.metricOptions, m.withDefaults(cfg.metricOptions), report)
+			for _, a := range m.Attributes {
+				if i := slices.IndexFunc(cfg.Attributes, func(b attributeConfig) bool { return b.Name == a.Name }); i >= 0 && cfg.Attributes[i] == a {
+					report("metric %s: attribute %s repeats the top-level attribute unchanged", m.Name, a.Name)
+				}
+			}
+		}
+	}
+	if cfg.MinMetrics > 0 && cfg.MinMetrics == cfg.MaxMetrics {
+		report("minMetrics and maxMetrics are both %d, every service has the same number of metrics, set metrics: %d instead", cfg.MinMetrics, cfg.MinMetrics)
+	}
+
+	type attributeList struct {
+		prefix string
+		attrs  []attributeConfig
+	}
+	attrLists := []attributeList{{"", cfg.Attributes}, {"resource ", cfg.ResourceAttributes}}
+	for _, m := range cfg.Metrics.Definitions {
+		attrLists = append(attrLists, attributeList{"metric " + m.Name + ": ", m.Attributes})
+	}
+	for _, l := range attrLists {
+		for _, a := range l.attrs {
+			if a.Template != "" && a.Cardinality > 1 && !strings.Contains(a.Template, "{{index}}") {
+				report("%sattribute %s: the template has no {{index}}, so its %d values are the same", l.prefix, a.Name, a.Cardinality)
+			}
+			if a.OmitProbability == 1 {
+				report("%sattribute %s: omitProbability 1 leaves it out of every data point", l.prefix, a.Name)
+			} else if a.EmptyProbability == 1 && a.Cardinality > 1 {
+				report("%sattribute %s: emptyProbability 1 makes all its %d values empty", l.prefix, a.Name, a.Cardinality)
+			}
+		}
+	}
+
+	if len(cfg.Tenants) > 0 {
+		services, metrics := true, true
+		for _, tenant := range cfg.Tenants {
+			services = services && tenant.Services > 0
+			metrics = metrics && tenant.Metrics > 0
+		}
+		if services && cfg.Services > 0 {
+			report("services has no effect, every tenant sets its own services")
+		}
+		if metrics && cfg.Metrics.Count > 0 {
+			report("the metrics count has no effect, every tenant sets its own metrics")
+		}
+	}
+	if f := cfg.MonotonicFraction; f != nil {
+		counters := slices.ContainsFunc(cfg.metrics(1), func(m metricConfig) bool {
+			return m.Type == metricCounter || m.Type == metricUpDownCounter
+		})
+		if !counters {
+			report("monotonicFraction has no effect without counter metrics")
+		} else if *f == 1 {
+			report("monotonicFraction 1 keeps every counter monotonic, the default")
+		}
+	}
+	if len(cfg.HourlyLoad) > 0 && !slices.ContainsFunc(cfg.HourlyLoad, func(load float64) bool { return load != 1 }) {
+		report("hourlyLoad is 1 for every hour, the default")
+	}
+	if !detect {
+		keys := []string{string(semconv.ServiceNameKey)}
+		for _, a := range cfg.ResourceAttributes {
+			keys = append(keys, a.key())
+		}
+		for _, entity := range cfg.Entities {
+			for _, key := range entity.IDKeys {
+				if !slices.Contains(keys, key) {
+					report("entity %s is never referenced, its id key %s is not a resource attribute", entity.Type, key)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// lintMetricOptions reports the options set in own that have no effect on
+// a metric with the resolved options, and values that make an option
+// pointless.
+func lintMetricOptions(name string, own, resolved metricOptions, report func(string, ...any)) {
+	for _, opt := range metricOptionUses {
+		if !opt.set(own) {
+			continue
+		}
+		if why := opt.unused(resolved); why != "" {
+			report("%s: %s has no effect, %s", name, opt.name, why)
+		}
+	}
+	if p := own.EmitProbability; p != nil && *p == 0 {
+		report("%s: emitProbability 0 never records it", name)
+	} else if p != nil && *p == 1 {
+		report("%s: emitProbability 1 records it every interval, the default", name)
+	}
+}
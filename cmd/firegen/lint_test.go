@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintConfig(t *testing.T) {
+	path := writeConfig(t, "firegen.yaml", `
+max: 10
+step: 1
+metrics:
+  - name: requests
+    type: counter
+    rate: 5
+    min: 0.5
+  - name: latency
+    type: histogram
+    buckets: [5]
+    bucketCounts: [1, 1]
+    precision: 2
+  - name: load
+    emitProbability: 1
+attributes:
+  - name: region
+    cardinality: 2
+    omitProbability: 1
+resourceAttributes:
+  - name: k8s.pod.uid
+    cardinality: 3
+    template: "{{service}}"
+entities:
+  - type: k8s.pod
+    idKeys: [k8s.pod.uid]
+  - type: k8s.node
+    idKeys: [k8s.node.uid]
+`)
+	cfg, err := loadConfig([]string{path}, mergeAppend)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"top-level step has no effect on any metric",
+		"metric requests: min has no effect, rate sets the increase",
+		"metric latency: precision has no effect, bucketCounts record the bucket boundaries unrounded",
+		"metric load: emitProbability 1 records it every interval, the default",
+		"attribute region: omitProbability 1 leaves it out of every data point",
+		"resource attribute k8s.pod.uid: the template has no {{index}}, so its 3 values are the same",
+		"entity k8s.node is never referenced, its id key k8s.node.uid is not a resource attribute",
+	}, lintConfig(cfg, false))
+	assert.NotContains(t, lintConfig(cfg, true), "entity k8s.node is never referenced, its id key k8s.node.uid is not a resource attribute")
+
+	path = writeConfig(t, "firegen.yaml", `
+metrics: 2
+pattern: randomwalk
+step: 0.1
+attributes:
+  - name: region
+    cardinality: 2
+    template: "region-{{index}}"
+`)
+	cfg, err = loadConfig([]string{path}, mergeAppend)
+	require.NoError(t, err)
+	assert.Empty(t, lintConfig(cfg, false))
+}
@@ -1,238 +1,2356 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"iter"
 	"log"
+	"maps"
+	"math"
 	"math/rand"
+	randv2 "math/rand/v2"
 	"os"
 	"os/signal"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/expr-lang/expr/vm"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-	"google.golang.org/grpc/credentials/insecure"
-	"gopkg.in/yaml.v2"
 )
 
-type config struct {
-	Metrics    int               `yaml:"metrics"`
-	Interval   int               `yaml:"interval"`
-	Services   int               `yaml:"services"`
-	Attributes []attributeConfig `yaml:"attributes"`
+// service identifies one of the simulated services.
+type service struct {
+	index int
+	name  string
 }
 
-type attributeConfig struct {
-	Name        string `yaml:"name"`
-	Cardinality int    `yaml:"cardinality"`
+// infoLog prints informational output. Errors are always printed to stderr
+// with the standard logger, even when -quiet discards infoLog's output.
+var infoLog = log.Default()
+
+func main() {
+	var opts options
+	flag.Var(&opts.configFiles, "config", "Path to config file, repeatable; later files are merged over earlier ones (default firegen.yaml)")
+	flag.StringVar(&opts.configMerge, "config-merge", mergeAppend, "How later config files merge the attributes list: append or replace")
+	flag.StringVar(&opts.endpoint, "endpoint", "localhost:4317", "OTLP endpoint")
+	flag.BoolVar(&opts.plaintext, "plaintext", false, "Use plaintext connection instead of TLS")
+	flag.StringVar(&opts.token, "token", "", "Bearer token for authentication (default: $FIREGEN_TOKEN)")
+	flag.StringVar(&opts.username, "username", "", "Username for Basic authentication")
+	flag.StringVar(&opts.password, "password", "", "Password for Basic authentication (default: $FIREGEN_PASSWORD)")
+	flag.BoolVar(&opts.useHTTP, "http", false, "Use HTTP instead of gRPC")
+	flag.StringVar(&opts.protocol, "protocol", "", "Protocol to export with: grpc, http, kafka, or stdout to print the exports as OTLP JSON (default: grpc, or http with -http)")
+	flag.StringVar(&opts.kafka.brokers, "kafka-brokers", "localhost:9092", "Comma-separated Kafka seed brokers of -protocol kafka, replacing -endpoint")
+	flag.StringVar(&opts.kafka.topic, "kafka-topic", "otlp_metrics", "Kafka topic of -protocol kafka")
+	flag.StringVar(&opts.kafka.sasl, "kafka-sasl-mechanism", "", "SASL mechanism of -protocol kafka: plain, scram-sha-256, scram-sha-512 or oauthbearer (default: oauthbearer with -token, plain with -username)")
+	flag.StringVar(&opts.tlsVersion, "tls-min-version", "", "Minimum TLS version of the exporters: 1.0, 1.1, 1.2 or 1.3 (default: Go's default)")
+	flag.StringVar(&opts.tlsCiphers, "tls-cipher-suites", "", "Comma-separated TLS 1.2 cipher suites the exporters offer, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (default: Go's default)")
+	flag.StringVar(&opts.urlPath, "http-url-path", "", "URL path of the OTLP HTTP endpoint, e.g. /otlp/v1/metrics (default: /v1/metrics)")
+	flag.DurationVar(&opts.timeout, "timeout", 1*time.Second, "Request timeout")
+	flag.StringVar(&opts.userAgent, "user-agent", "firegen/"+version(), "User-Agent of OTLP requests")
+	flag.DurationVar(&opts.otlpTimeout, "otlp-timeout", 0, "Timeout of the OTLP exporter for a whole export including its retries (default: the exporter's 10s)")
+	flag.Int64Var(&opts.seed, "seed", 0, "Seed for random number generation (default: derived from the current time)")
+	flag.Float64Var(&opts.presence, "attribute-presence", 1.0, "Probability that each attribute combination is recorded in an interval")
+	flag.BoolVar(&opts.replay, "replay", false, "Re-send the data collected on the first tick unchanged on every interval")
+	flag.BoolVar(&opts.golden, "golden", false, "Instead of generating metrics, send the built-in golden dataset once and exit, for end-to-end verification")
+	flag.StringVar(&opts.replayFile, "replay-file", "", "Instead of generating metrics, send the exports of an OTLP JSON file written by -out-file in a loop")
+	flag.BoolVar(&opts.restamp, "replay-restamp", false, "Shift the timestamps of the exports sent with -replay-file to the time they are sent")
+	flag.StringVar(&opts.metricOrder, "metric-order", metricOrderSDK, "Order of the metrics of a scope in the exports and their chunks: sdk, the order the SDK collects them in, name, reverse of the SDK order or shuffle, reproducibly with -seed")
+	flag.StringVar(&opts.points.order, "attribute-order", orderSorted, "Order of the data point attributes on the wire: sorted by key like the SDK, reverse or shuffle, reproducibly with -seed")
+	flag.StringVar(&opts.points.flags, "data-point-flags", "", "Set these OTLP flags on the exported data points, comma-separated names or numeric masks, e.g. no-recorded-value (default: none)")
+	flag.Float64Var(&opts.points.flagged, "data-point-flags-fraction", 1, "Fraction of the data points -data-point-flags are set on")
+	flag.StringVar(&opts.outFile, "out-file", "", "Append each export to this file as newline-delimited OTLP JSON")
+	flag.StringVar(&opts.promAddr, "prometheus-addr", "", "Serve the generated series on a Prometheus scrape endpoint at /metrics on this address, e.g. :9100")
+	flag.BoolVar(&opts.quiet, "quiet", false, "Suppress all output except errors")
+	flag.DurationVar(&opts.heartbeat, "heartbeat", 0, "Log a one-line status this often, also with -quiet, e.g. 1m (default: never)")
+	flag.StringVar(&opts.valueMode, "attribute-values", valuesShared, "Whether services share attribute values (shared), use disjoint value ranges (offset) or values prefixed with the service name (unique)")
+	flag.DurationVar(&opts.conn.startup, "startup-timeout", 0, "Retry resolving the endpoint and creating the exporter with backoff for up to this long at startup")
+	flag.Float64Var(&opts.stale.fraction, "stale-fraction", 0, "Probability that a gauge series is marked stale in an interval")
+	flag.IntVar(&opts.stale.intervals, "stale-intervals", 1, "Number of intervals a stale series stays silent before it resumes")
+	flag.DurationVar(&opts.duration, "duration", 0, "Stop after running for this long (default: run until interrupted)")
+	flag.BoolVar(&opts.benchmark, "benchmark", false, "Collect and export as fast as possible without waiting for the interval and report the achieved throughput")
+	flag.StringVar(&opts.reader.mode, "reader", readerManual, "Metric reader of the services: manual collects and exports on every interval, periodic uses the SDK's PeriodicReader like an instrumented application")
+	flag.DurationVar(&opts.reader.every, "export-interval", 0, "Export interval of -reader periodic (default: the config interval)")
+	flag.IntVar(&opts.cardinality.limit, "cardinality-limit", 0, "Cap the series of every instrument of a service at this many, aggregating the measurements of further series into one otel.metric.overflow series like a client-side limited SDK (default: no limit)")
+	flag.Float64Var(&opts.points.duplicates, "duplicate-points", 0, "Probability that a data point is repeated in its export with the same attributes and timestamp, producing invalid OTLP")
+	flag.Float64Var(&opts.negative, "inject-negative-deltas", 0, "Probability that a counter increment is negated, producing invalid non-monotonic counters")
+	flag.BoolVar(&opts.skipEmpty, "skip-empty-exports", false, "Skip exporting collections that contain no data points")
+	flag.IntVar(&opts.rampStep, "payload-ramp", 0, "Pad the resources of the exports with this many more bytes every interval until the collector rejects a request, to find its request size limit")
+	flag.IntVar(&opts.maxPoints, "max-points-per-request", 0, "Split each export into requests of at most this many data points (default: one request per export)")
+	flag.IntVar(&opts.requests, "requests-per-interval", 0, "Send this many OTLP requests across all services on every interval, splitting the exports and filling up with requests without data points, to test request rates independently of data volume")
+	flag.IntVar(&opts.conn.initConc, "exporter-init-concurrency", 0, "Number of services that create their exporters in parallel during startup (default: 0, all at once)")
+	flag.DurationVar(&opts.conn.launch, "launch-interval", 0, "Delay between starting consecutive services, spreading out the connection setup (default: start all services at once)")
+	flag.Float64Var(&opts.cardinality.jitter, "cardinality-jitter", 0, "Vary the series of every service by up to this percentage around the configured attribute cardinality, reproducibly with -seed (default: 0, every service has the same series)")
+	flag.IntVar(&opts.cardinality.growth, "cardinality-growth", 0, "Add this many new series per interval, until maxSeries is reached if configured")
+	flag.Float64Var(&opts.churn.rate, "resource-churn-rate", 0, "New resources per interval across all services, each replacing the resource of a service with a new -resource-churn-attribute value, to test resource re-identification (default: 0, none)")
+	flag.StringVar(&opts.churn.key, "resource-churn-attribute", "service.instance.id", "Resource attribute whose value -resource-churn-rate changes")
+	flag.IntVar(&opts.newSeries.perInterval, "new-series-per-interval", 0, "Number of brand-new gauge series added across all services on every interval, replacing the oldest ones, to test new-series rate limits")
+	flag.IntVar(&opts.newSeries.lifetime, "new-series-lifetime", 1, "Number of intervals each series of -new-series-per-interval is recorded for before it expires")
+	flag.IntVar(&opts.burst.series, "burst-series", 0, "Number of short-lived gauge series added across all services during each burst")
+	flag.DurationVar(&opts.burst.every, "burst-every", 0, "Start a burst of -burst-series series this often, e.g. 1h")
+	flag.DurationVar(&opts.burst.duration, "burst-duration", 0, "How long each burst lasts before its series are dropped, e.g. 5m")
+	flag.Float64Var(&opts.chaos.probability, "chaos-probability", 0, "Chaos testing: probability that an export is deliberately dropped and counted as an injected failure")
+	flag.DurationVar(&opts.chaos.every, "chaos-every", 0, "Chaos testing: start an outage in which all exports are deliberately dropped this often, e.g. 30m")
+	flag.DurationVar(&opts.chaos.duration, "chaos-duration", 0, "Chaos testing: how long each outage of -chaos-every lasts, e.g. 2m")
+	flag.Float64Var(&opts.flap.fraction, "flap-fraction", 0, "Fraction of the services that flap, pausing and resuming their ticks on a reproducible schedule like crash-looping pods (default: 0, none)")
+	flag.DurationVar(&opts.flap.period, "flap-period", time.Minute, "Average duration of each up and down phase of the -flap-fraction services, each random between half and one and a half of it")
+	flag.Float64Var(&opts.corrupt.probability, "corrupt-probability", 0, "Negative testing: probability that an export request is deliberately damaged on the wire, making it undecodable (default: 0, never)")
+	flag.StringVar(&opts.corrupt.mode, "corrupt-mode", corruptTruncate, "How -corrupt-probability damages requests: truncate the protobuf, or gzip compress every request and flip a byte of the damaged streams (gzip, HTTP only)")
+	flag.StringVar(&opts.interceptors.names, "grpc-interceptors", "", "Comma-separated built-in unary interceptors chained on the gRPC exporters, outermost first: metadata adds x-request-id and traceparent, log logs every call, fail fails calls with -grpc-fail-probability")
+	flag.Float64Var(&opts.interceptors.failProb, "grpc-fail-probability", 0, "Probability that the fail interceptor of -grpc-interceptors fails a call with status Unavailable before it is sent")
+	flag.Float64Var(&opts.malformed.probability, "malformed-probability", 0, "Negative testing: probability that an export request is sent with an empty resource or empty scopes, producing invalid OTLP (default: 0, never)")
+	flag.StringVar(&opts.malformed.mode, "malformed-mode", malformedResource, "What -malformed-probability strips from the requests: the resource, or the scope of every scope metrics")
+	flag.BoolVar(&opts.conflicting, "conflicting-types", false, "Emit every metric with a different instrument type from every other service, producing invalid data")
+	flag.BoolVar(&opts.schemaClash, "conflicting-schema-urls", false, "Create every resource by merging resources with different schema URLs, a merge conflict the SDK resolves by dropping the schema URL")
+	flag.BoolVar(&opts.detect, "detect-resources", false, "Add host, OS and process attributes detected from the environment to the resources")
+	flag.BoolVar(&opts.delta.histograms, "delta-histograms", false, "Export histograms with delta instead of cumulative temporality, with the min and max of each interval")
+	flag.Float64Var(&opts.delta.fraction, "delta-fraction", 0, "Fraction of the services that export counters and histograms with delta temporality, the others cumulative, to mix both temporalities for the same metric names (default: 0, all cumulative)")
+	flag.BoolVar(&opts.delta.gauges, "delta-gauges", false, "Export gauges as non-monotonic sums with delta temporality, recording the change of each series per interval")
+	flag.BoolVar(&opts.sequence, "sequence-numbers", false, "Loss-detection mode: add an incrementing firegen.seq attribute to every data point of a series, making every data point a series of its own")
+	flag.IntVar(&opts.conn.reconnect, "reconnect-after", 0, "Recreate the exporter of a service after this many consecutive failed exports (default: never)")
+	flag.DurationVar(&opts.skew, "time-skew", 0, "Shift the timestamps of all data points by this much, e.g. +5m into the future or -1h into the past")
+	flag.DurationVar(&opts.drift, "clock-drift-max", 0, "Shift the timestamps of each service by its own random offset of at most this much in either direction, e.g. 2s")
+	flag.StringVar(&opts.clockStart, "clock-start", "", "Event time of the data points when firegen starts, in RFC 3339 format, e.g. 2025-01-01T00:00:00Z to backfill from then (default: now)")
+	flag.Float64Var(&opts.clockSpeed, "clock-speed", 1, "How fast the event time of the data points runs relative to the wall clock, e.g. 60 to record an hour of data every minute")
+	flag.BoolVar(&opts.check, "check-connection", false, "Send a single data point before starting the services and exit if the export fails")
+	flag.BoolVar(&opts.estimate, "estimate-bandwidth", false, "Generate one export of the first service, report its OTLP size and the projected bandwidth of all services, and exit without sending anything")
+	flag.IntVar(&opts.conn.perConn, "resources-per-connection", 0, "Number of services, each with its own resource, that share one connection (default: all services of a tenant and transport share one)")
+	flag.IntVar(&opts.conn.parallelism, "export-parallelism", 1, "Number of requests a service sends in parallel when -max-points-per-request splits its exports, each over its own exporter on the shared connection")
+	flag.BoolVar(&opts.single, "single-resource", false, "Collapse all services into the scopes of a single resource, producing one huge export per interval")
+	flag.IntVar(&opts.recorders, "record-concurrency", 1, "Number of goroutines a service records its metrics with on every interval")
+	flag.IntVar(&opts.inflight.max, "max-inflight", 0, "Maximum number of exports in flight across all services (default: unlimited)")
+	flag.BoolVar(&opts.inflight.skipBusy, "max-inflight-skip", false, "Skip exports that find all -max-inflight slots taken instead of waiting for a free slot")
+	flag.Func("terminate-with-value", "On shutdown, record this sentinel value for every gauge series in a final export, e.g. 0", func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		opts.terminate = &v
+		return err
+	})
+	flag.BoolVar(&opts.reload, "reload-on-sighup", false, "Re-read the config files on SIGHUP and restart the services to apply a changed number of services or interval, keeping the running config if the new one is invalid")
+	flag.BoolVar(&opts.failFast, "fail-fast", false, "Exit on the first error of any service instead of stopping only the failed service and keeping the others running")
+	flag.BoolVar(&opts.lint, "lint", false, "Check the config for unreachable or redundant settings, report them and exit, non-zero if there are any")
+	flag.BoolVar(&opts.version, "version", false, "Print the version, git commit and build date and exit")
+	flag.Parse()
+
+	if opts.version {
+		commit, date := buildInfo()
+		fmt.Printf("firegen %s (commit %s, built %s)\n", version(), commit, date)
+		return
+	}
+
+	// Secrets can be passed in the environment to keep them out of the
+	// process list and shell history, the flags take precedence.
+	if opts.token == "" {
+		opts.token = os.Getenv("FIREGEN_TOKEN")
+	}
+	if opts.password == "" {
+		opts.password = os.Getenv("FIREGEN_PASSWORD")
+	}
+
+	if opts.quiet {
+		infoLog = log.New(io.Discard, "", 0)
+	}
+
+	if err := opts.validate(); err != nil {
+		log.Fatalf("Invalid %v", err)
+	}
+	if opts.cardinality.limit > 0 {
+		setCardinalityLimit(opts.cardinality.limit)
+	}
+	if opts.golden {
+		rm, err := sendGolden(context.Background(), opts)
+		if err != nil {
+			log.Fatalf("Failed to send the golden dataset to %s: %v", opts.endpoint, err)
+		}
+		infoLog.Printf("Sent golden dataset version %d to %s, %d data points in %d metrics", goldenVersion, opts.endpoint, countDataPoints(rm), len(rm.ScopeMetrics[0].Metrics))
+		return
+	}
+	if opts.replayFile != "" {
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+		if opts.duration > 0 {
+			ctx, cancel = context.WithTimeout(ctx, opts.duration)
+			defer cancel()
+		}
+		infoLog.Printf("Replaying %s to %s", opts.replayFile, opts.endpoint)
+		var st stats
+		if err := replayFile(ctx, opts, opts.replayFile, opts.restamp, &st); err != nil {
+			log.Fatalf("Failed to replay %s: %v", opts.replayFile, err)
+		}
+		infoLog.Printf("Sent %d data points in %d exports, %d failed exports", st.points.Load(), st.exports.Load(), st.failures.Load())
+		return
+	}
+
+	if len(opts.configFiles) == 0 {
+		opts.configFiles = stringList{"firegen.yaml"}
+	}
+	cfg, err := loadConfig(opts.configFiles, opts.configMerge)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	// Reloads compare the config files with the config as written, before
+	// the defaults below change cfg in place.
+	var loaded config
+	if opts.reload {
+		if loaded, err = loadConfig(opts.configFiles, opts.configMerge); err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	}
+	// The linter sees the config as written, before the defaults below.
+	var lintIssues []string
+	if opts.lint {
+		lintIssues = lintConfig(cfg, opts.detect)
+	}
+	if cfg.MinMetrics != 0 || cfg.MaxMetrics != 0 {
+		if len(cfg.Metrics.Definitions) > 0 {
+			log.Fatalf("Invalid config: minMetrics and maxMetrics require a metrics count, but metrics are defined as a list")
+		} else if cfg.Metrics.Count > 0 {
+			log.Fatalf("Invalid config: minMetrics and maxMetrics cannot be combined with a metrics count")
+		}
+		cfg.MinMetrics = max(1, cfg.MinMetrics)
+		if cfg.MaxMetrics < cfg.MinMetrics {
+			log.Fatalf("Invalid config: maxMetrics %d must not be less than minMetrics %d", cfg.MaxMetrics, cfg.MinMetrics)
+		}
+		cfg.Metrics.Count = cfg.MaxMetrics
+	}
+	cfg.Metrics.Count = max(1, cfg.Metrics.Count)
+	cfg.Interval = max(1, cfg.Interval)
+	cfg.Services = max(1, cfg.Services)
+	cfg.Scopes = max(1, cfg.Scopes)
+	opts.cardinality.maxSeries = max(0, cfg.MaxSeries)
+	if len(cfg.HourlyLoad) > 0 {
+		if len(cfg.HourlyLoad) != 24 {
+			log.Fatalf("Invalid config: hourlyLoad has %d entries, expected one per hour of the day", len(cfg.HourlyLoad))
+		}
+		for h, load := range cfg.HourlyLoad {
+			if load < 0 || load > 1 {
+				log.Fatalf("Invalid config: hourlyLoad %g of hour %d must be between 0 and 1", load, h)
+			}
+		}
+	}
+	opts.hourlyLoad = cfg.HourlyLoad
+	if f := cfg.MonotonicFraction; f != nil && (*f < 0 || *f > 1) {
+		log.Fatalf("Invalid config: monotonicFraction %g must be between 0 and 1", *f)
+	}
+	httpTransport := opts.useHTTP && len(cfg.Transports) == 0
+	if len(cfg.Transports) > 0 {
+		if opts.protocol == protocolKafka || opts.protocol == protocolStdout {
+			log.Fatalf("Invalid config: transports cannot be combined with -protocol %s", opts.protocol)
+		}
+		total := 0.0
+		for i, transport := range cfg.Transports {
+			switch transport.Protocol {
+			case protocolGRPC, protocolHTTP:
+			default:
+				log.Fatalf("Invalid config: protocol %q of transport %d must be %s or %s", transport.Protocol, i, protocolGRPC, protocolHTTP)
+			}
+			if transport.Endpoint == "" {
+				log.Fatalf("Invalid config: transport %d has no endpoint", i)
+			} else if transport.Fraction <= 0 || transport.Fraction > 1 {
+				log.Fatalf("Invalid config: fraction %g of transport %d must be greater than 0 and at most 1", transport.Fraction, i)
+			}
+			total += transport.Fraction
+			httpTransport = httpTransport || transport.Protocol == protocolHTTP
+		}
+		if math.Abs(total-1) > 1e-9 {
+			log.Fatalf("Invalid config: the fractions of the transports add up to %g, expected 1", total)
+		}
+	}
+	if opts.urlPath != "" && !httpTransport {
+		log.Fatalf("Invalid -http-url-path: requires -http or an http transport")
+	}
+	for i, entity := range cfg.Entities {
+		if entity.Type == "" {
+			log.Fatalf("Invalid config: entity %d has no type", i)
+		} else if len(entity.IDKeys) == 0 {
+			log.Fatalf("Invalid config: entity %s has no idKeys", entity.Type)
+		}
+	}
+	if len(cfg.Entities) > 0 {
+		if opts.points.rewrite == nil {
+			opts.points.rewrite = newRewriter(0, 0, orderSorted, opts.seed)
+		}
+		opts.points.rewrite.entities = cfg.Entities
+	}
+	if cfg.DuplicateScopeMetrics && cfg.Scopes == 1 {
+		log.Fatalf("Invalid config: duplicateScopeMetrics requires more than one scope")
+	}
+	tenants := cfg.Tenants
+	if len(tenants) == 0 {
+		tenants = []tenantConfig{{Services: cfg.Services}}
+	}
+	totalServices := 0
+	for i := range tenants {
+		if tenants[i].Name == "" {
+			tenants[i].Name = fmt.Sprintf("tenant-%02d", i)
+		}
+		if tenants[i].Metrics > 0 && len(cfg.Metrics.Definitions) > 0 {
+			log.Fatalf("Invalid config: tenant %s sets a metrics count, but metrics are defined as a list", tenants[i].Name)
+		} else if tenants[i].Metrics > 0 && cfg.MaxMetrics > 0 {
+			log.Fatalf("Invalid config: tenant %s sets a metrics count, but minMetrics and maxMetrics are set", tenants[i].Name)
+		}
+		tenants[i].Services = max(1, cmp.Or(tenants[i].Services, cfg.Services))
+		tenants[i].Metrics = max(1, cmp.Or(tenants[i].Metrics, cfg.Metrics.Count))
+		totalServices += tenants[i].Services
+	}
+	if opts.single && len(cfg.Tenants) > 0 {
+		log.Fatalf("Invalid -single-resource: cannot be combined with tenants")
+	}
+	if err := cfg.metricOptions.validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	attrLists := [][]attributeConfig{cfg.Attributes, cfg.ResourceAttributes}
+	for _, m := range cfg.Metrics.Definitions {
+		attrLists = append(attrLists, m.Attributes)
+	}
+	for l, attrs := range attrLists {
+		for i := range attrs {
+			attrs[i].Cardinality = max(1, attrs[i].Cardinality)
+			if err := attrs[i].validate(); err != nil {
+				log.Fatalf("Invalid config: %v", err)
+			}
+			if attrs[i].pareto() && l == 1 {
+				log.Fatalf("Invalid config: attribute %s: resourceAttributes cannot follow a power law", attrs[i].Name)
+			}
+			if attrs[i].changes() && l != 1 {
+				log.Fatalf("Invalid config: attribute %s: only resourceAttributes can change over time", attrs[i].Name)
+			}
+			key := attribute.Key(attrs[i].key())
+			if attrs[i].OmitProbability != 0 {
+				if l == 1 {
+					log.Fatalf("Invalid config: attribute %s: resourceAttributes cannot be omitted", attrs[i].Name)
+				}
+				if p, ok := opts.optional[key]; ok && p != attrs[i].OmitProbability {
+					log.Fatalf("Invalid config: attribute %s: conflicting omitProbability %g and %g", attrs[i].Name, p, attrs[i].OmitProbability)
+				}
+				if opts.optional == nil {
+					opts.optional = make(map[attribute.Key]float64)
+				}
+				opts.optional[key] = attrs[i].OmitProbability
+			}
+			if attrs[i].EmptyProbability != 0 {
+				if l == 1 {
+					log.Fatalf("Invalid config: attribute %s: resourceAttributes cannot be empty", attrs[i].Name)
+				}
+				if p, ok := opts.empty[key]; ok && p != attrs[i].EmptyProbability {
+					log.Fatalf("Invalid config: attribute %s: conflicting emptyProbability %g and %g", attrs[i].Name, p, attrs[i].EmptyProbability)
+				}
+				if opts.empty == nil {
+					opts.empty = make(map[attribute.Key]float64)
+				}
+				opts.empty[key] = attrs[i].EmptyProbability
+			}
+		}
+	}
+	var kinds metricKinds
+	names := make(map[string]bool)
+	for i, m := range cfg.metrics(1) {
+		if m.Name == "" {
+			log.Fatalf("Invalid config: metric %d has no name", i)
+		} else if names[m.Name] {
+			log.Fatalf("Invalid config: duplicate metric %s", m.Name)
+		}
+		names[m.Name] = true
+		if f := cfg.MonotonicFraction; f != nil && *f < 1 && m.Rate != nil && (m.Type == metricCounter || m.Type == metricUpDownCounter) {
+			log.Fatalf("Invalid config: metric %s: monotonicFraction cannot be combined with rate, up-down counters have no rate", m.Name)
+		}
+		if err := m.validate(); err != nil {
+			log.Fatalf("Invalid config: metric %s: %v", m.Name, err)
+		}
+		switch m.Type {
+		case metricCounter:
+			kinds.counters = true
+		case metricUpDownCounter:
+			kinds.upDownCounters = true
+		case "", metricGauge:
+			kinds.gauges = true
+		case metricHistogram:
+			kinds.histograms = true
+		}
+		kinds.timestamps = kinds.timestamps || m.Pattern == patternTimestamp
+		kinds.lifetimes = kinds.lifetimes || m.Lifetime > 0
+	}
+	// Only one metric of a count is validated, the split can turn the rest
+	// into up-down counters.
+	if f := cfg.MonotonicFraction; f != nil && *f < 1 && kinds.counters {
+		kinds.upDownCounters = true
+	}
+	if opts.lint {
+		for _, issue := range lintIssues {
+			fmt.Println(issue)
+		}
+		if len(lintIssues) > 0 {
+			log.Fatalf("Found %d issues in the config", len(lintIssues))
+		}
+		infoLog.Printf("Found no issues in the config")
+		return
+	}
+	if err := opts.validateConfig(cfg, kinds); err != nil {
+		log.Fatalf("Invalid %v", err)
+	}
+	interval := time.Duration(cfg.Interval) * time.Second
+	var output *jsonlWriter
+	if opts.outFile != "" {
+		f, err := os.OpenFile(opts.outFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", opts.outFile, err)
+		}
+		defer f.Close()
+		output = &jsonlWriter{w: f, rewrite: opts.points.rewrite}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if opts.duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
+	}
+	if opts.rampStep > 0 {
+		opts.points.rewrite.ramp.stop = cancel
+	}
+
+	if opts.promAddr != "" && !opts.estimate {
+		opts.scrape = newScrapeTarget()
+		if err := opts.scrape.serve(ctx, opts.promAddr); err != nil {
+			log.Fatalf("Failed to serve Prometheus scrape endpoint: %v", err)
+		}
+	}
+
+	allAttributes := serviceAttributes(cfg.Attributes, 0, opts.valueMode, service{}, opts.seed)
+	perService := opts.valueMode != valuesShared || opts.cardinality.jitter > 0 ||
+		slices.ContainsFunc(cfg.Attributes, func(a attributeConfig) bool { return a.Template != "" || a.pareto() })
+
+	attrCardinality := cardinality(cfg.Attributes)
+	resourceCardinality := cardinality(cfg.ResourceAttributes)
+	tenantMetrics := make([][]metricConfig, len(tenants))
+	for i, tenant := range tenants {
+		tenantMetrics[i] = cfg.metrics(tenant.Metrics)
+	}
+	// With a metrics range every service registers the first metricCounts[i]
+	// metrics of its tenant, drawn from a generator of their own so the
+	// counts do not change the values of the services.
+	metricCounts := drawMetricCounts(cfg, totalServices, opts.seed)
+	// With -cardinality-jitter every service scales its series by
+	// cardScales[i], drawn like the metric counts.
+	cardScales := drawCardScales(opts.cardinality.jitter, totalServices, opts.seed)
+
+	if len(cfg.Tenants) == 0 && metricCounts != nil {
+		infoLog.Printf("Generating %d services, %d-%d metrics per service, %d attributes", cfg.Services, cfg.MinMetrics, cfg.MaxMetrics, len(cfg.Attributes))
+	} else if len(cfg.Tenants) == 0 {
+		infoLog.Printf("Generating %d services, %d metrics, %d attributes", cfg.Services, len(tenantMetrics[0]), len(cfg.Attributes))
+	} else {
+		infoLog.Printf("Generating %d services in %d tenants, %d attributes", totalServices, len(tenants), len(cfg.Attributes))
+	}
+	infoLog.Printf("Interval %s", interval)
+	infoLog.Printf("Seed %d", opts.seed)
+	infoLog.Printf("Attribute values %s", opts.valueMode)
+	infoLog.Printf("")
+	infoLog.Printf("Attribute cardinality per metric %d", attrCardinality)
+	if cfg.Scopes > 1 {
+		infoLog.Printf("Scopes per service %d", cfg.Scopes)
+	}
+	if cfg.DuplicateScopeMetrics {
+		infoLog.Printf("Registering every metric in every scope, metric names collide across scopes")
+	}
+	totalSeries := opts.logSeries(cfg, tenants, tenantMetrics, metricCounts, cardScales, attrCardinality)
+	infoLog.Printf("Total series %d", totalSeries)
+	if opts.cardinality.maxSeries > 0 && totalSeries > opts.cardinality.maxSeries {
+		// The last warning is the one about the total series.
+		warnings := cfg.cardinalityWarnings(totalSeries, opts.cardinality.maxSeries)
+		log.Fatalf("Invalid config: maxSeries: %s", warnings[len(warnings)-1])
+	}
+	for _, warning := range cfg.cardinalityWarnings(totalSeries, warnSeries) {
+		infoLog.Printf("Warning: %s", warning)
+	}
+	if cfg.MonotonicFraction != nil || kinds.upDownCounters {
+		var monotonic, nonMonotonic int
+		for _, metrics := range tenantMetrics {
+			for _, m := range metrics {
+				switch m.Type {
+				case metricCounter:
+					monotonic++
+				case metricUpDownCounter:
+					nonMonotonic++
+				}
+			}
+		}
+		infoLog.Printf("Sums %d monotonic, %d non-monotonic", monotonic, nonMonotonic)
+	}
+	opts.logSettings(cfg, totalServices, resourceCardinality, interval)
+	// The transport of each service, nil for all services to use the
+	// command line protocol and endpoint.
+	var transports []int
+	if opts.endpoint == "" {
+		infoLog.Printf("No endpoint, network export disabled")
+	} else if len(cfg.Transports) > 0 {
+		exporting := totalServices
+		if opts.single {
+			exporting = 1
+		}
+		transports = cfg.assignTransports(exporting)
+		counts := make([]int, len(cfg.Transports))
+		for _, t := range transports {
+			counts[t]++
+		}
+		for t, transport := range cfg.Transports {
+			infoLog.Printf("Transport %s to %s: %d services", transport.Protocol, transport.Endpoint, counts[t])
+		}
+	}
+
+	if opts.check && opts.endpoint != "" && !opts.estimate {
+		endpoints := []options{opts}
+		if len(cfg.Transports) > 0 {
+			endpoints = nil
+			for _, transport := range cfg.Transports {
+				endpoints = append(endpoints, opts.forTransport(transport))
+			}
+		}
+		for _, tenant := range tenants {
+			for _, endpointOpts := range endpoints {
+				t := time.Now()
+				if err := endpointOpts.forTenant(tenant).checkConnection(ctx); err != nil {
+					if len(cfg.Tenants) > 0 {
+						log.Fatalf("Connection check of tenant %s to %s failed: %v", tenant.Name, endpointOpts.endpoint, err)
+					}
+					log.Fatalf("Connection check to %s failed: %v", endpointOpts.endpoint, err)
+				}
+				if len(cfg.Tenants) > 0 {
+					infoLog.Printf("Connection check of tenant %s to %s succeeded in %dms", tenant.Name, endpointOpts.endpoint, time.Since(t).Milliseconds())
+				} else {
+					infoLog.Printf("Connection check to %s succeeded in %dms", endpointOpts.endpoint, time.Since(t).Milliseconds())
+				}
+			}
+		}
+	}
+
+	var scopeAttrs []attribute.KeyValue
+	for _, key := range slices.Sorted(maps.Keys(cfg.ScopeAttributes)) {
+		scopeAttrs = append(scopeAttrs, attribute.String(key, cfg.ScopeAttributes[key]))
+	}
+
+	// A single resource is generated by one service, with the scopes of
+	// all services.
+	collapsed := 1
+	if opts.single {
+		collapsed, totalServices = totalServices, 1
+		tenants[0].Services = 1
+	}
+	if opts.conn.initConc > 0 && opts.endpoint != "" && !opts.estimate {
+		opts.conn.init = newExporterInit(opts.conn.initConc, totalServices)
+	}
+	if opts.requests > 0 && opts.requests < totalServices {
+		log.Fatalf("Invalid -requests-per-interval %d: must be at least the number of services, %d", opts.requests, totalServices)
+	}
+
+	var st stats
+	st.series.Store(int64(totalSeries))
+	var wg sync.WaitGroup
+	start := time.Now()
+	opts.start = start
+	if opts.heartbeat > 0 && !opts.estimate {
+		go heartbeat(ctx, start, opts.heartbeat, &st)
+	}
+	pools := 0
+	// allFailed is set when every service of a launch stopped with an
+	// error, which shuts firegen down.
+	var allFailed atomic.Bool
+	// launchServices starts the services with ctx, which -reload-on-sighup
+	// cancels to stop them before it launches them again.
+	launchServices := func(ctx context.Context, interval time.Duration) {
+		i := 0
+		progress := max(1, totalServices/10)
+		// driftRng draws the clock drift of the services in order,
+		// separately from their own generators so the drift does not
+		// change their values.
+		driftRng := rand.New(rand.NewSource(opts.seed - 1))
+		// connections holds the current connection pool of each tenant and
+		// transport, whose services export with the same options. All of
+		// their services share it, or groups of -resources-per-connection.
+		connections := make(map[[2]int]*connectionPool)
+		pools = 0
+		// failed counts the services of this launch stopped by an error.
+		var failed atomic.Int64
+		for t, tenant := range tenants {
+			tenantOpts := opts.forTenant(tenant)
+			scopes, conflictingScopes := splitScopes(tenantMetrics[t], cfg.Scopes, cfg.DuplicateScopeMetrics)
+			for range tenant.Services {
+				if opts.conn.launch > 0 && i > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(opts.conn.launch):
+					}
+				}
+				serviceName := fmt.Sprintf("service-%04d", i)
+				svc := service{i, serviceName}
+				offset := time.Duration(float32(interval) * float32(i) / float32(totalServices))
+				rng := rand.New(rand.NewSource(opts.seed + int64(i)))
+				attributes := allAttributes
+				var cardScale float64
+				if cardScales != nil {
+					cardScale = cardScales[i]
+				}
+				if perService {
+					attributes = serviceAttributes(cfg.Attributes, cardScale, opts.valueMode, svc, opts.seed)
+				}
+				resourceIndex := i % resourceCardinality
+				// The services share the growth, bursts and new series, the first
+				// ones add one more series if it does not divide evenly.
+				serviceOpts := tenantOpts
+				serviceOpts.cardinality.scale = cardScale
+				serviceOpts.delta.enabled = fractionService(i, opts.delta.fraction)
+				serviceOpts.flap.enabled = fractionService(i, opts.flap.fraction)
+				if transports != nil {
+					serviceOpts = serviceOpts.forTransport(cfg.Transports[transports[i]])
+				}
+				if opts.endpoint != "" {
+					key := [2]int{t, -1}
+					if transports != nil {
+						key[1] = transports[i]
+					}
+					if pool := connections[key]; pool == nil || pool.members == opts.conn.perConn {
+						connections[key] = &connectionPool{}
+						pools++
+					}
+					connections[key].members++
+					serviceOpts.conn.pool = connections[key]
+				}
+				serviceOpts.cardinality.growth = opts.cardinality.growth / totalServices
+				// Every service churns at its share of the rate, the phases
+				// spread the churns of the services evenly over the
+				// intervals.
+				serviceOpts.churn.rate = opts.churn.rate / float64(totalServices)
+				serviceOpts.churn.phase = float64(i) / float64(totalServices)
+				if i < opts.cardinality.growth%totalServices {
+					serviceOpts.cardinality.growth++
+				}
+				if opts.drift > 0 {
+					serviceOpts.skew += time.Duration((2*driftRng.Float64() - 1) * float64(opts.drift))
+				}
+				serviceOpts.burst.series = opts.burst.series / totalServices
+				if i < opts.burst.series%totalServices {
+					serviceOpts.burst.series++
+				}
+				serviceOpts.newSeries.perInterval = opts.newSeries.perInterval / totalServices
+				if i < opts.newSeries.perInterval%totalServices {
+					serviceOpts.newSeries.perInterval++
+				}
+				serviceOpts.requests = opts.requests / totalServices
+				if i < opts.requests%totalServices {
+					serviceOpts.requests++
+				}
+				serviceScopes := collapsedScopes(i, collapsed, opts.conflicting, func(c int) ([][]metricConfig, [][]metricConfig) {
+					if metricCounts != nil {
+						return splitScopes(tenantMetrics[t][:metricCounts[c]], cfg.Scopes, cfg.DuplicateScopeMetrics)
+					}
+					return scopes, conflictingScopes
+				})
+				sc := serviceConfig{
+					svc:                svc,
+					scopes:             serviceScopes,
+					scopeAttrs:         scopeAttrs,
+					attributes:         attributes,
+					resourceAttributes: cfg.ResourceAttributes,
+					resourceIndex:      resourceIndex,
+					offset:             offset,
+					interval:           interval,
+					rng:                rng,
+					output:             output,
+					st:                 &st,
+					opts:               serviceOpts,
+				}
+				if opts.estimate {
+					sc.output, sc.offset = nil, 0
+					if err := generate(ctx, sc); err != nil {
+						log.Fatalf("Service %s failed: %v", serviceName, err)
+					}
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					st.services.Add(1)
+					defer st.services.Add(-1)
+					err := generate(ctx, sc)
+					if err == nil {
+						return
+					} else if opts.failFast {
+						log.Fatalf("Service %s failed: %v", serviceName, err)
+					}
+					st.failedServices.Add(1)
+					log.Printf("Service %s failed and stopped, the other services keep running: %v", serviceName, err)
+					if failed.Add(1) == int64(totalServices) {
+						log.Printf("All %d services failed, shutting down", totalServices)
+						allFailed.Store(true)
+						cancel()
+					}
+				}()
+				i++
+				if opts.conn.launch > 0 && (i%progress == 0 || i == totalServices) {
+					infoLog.Printf("Launched %d/%d services", i, totalServices)
+				}
+			}
+		}
+	}
+	servicesCtx, stopServices := context.WithCancel(ctx)
+	defer func() { stopServices() }()
+	launchServices(servicesCtx, interval)
+	if opts.estimate {
+		size, compressed := st.bytes.Load(), st.compressed.Load()
+		perSecond := float64(totalServices) / interval.Seconds()
+		infoLog.Printf("")
+		infoLog.Printf("Export size of service-0000 %d bytes, %d bytes gzip compressed", size, compressed)
+		infoLog.Printf("Estimated bandwidth of %d services %s/s, %s/s gzip compressed",
+			totalServices, formatBytes(float64(size)*perSecond), formatBytes(float64(compressed)*perSecond))
+		return
+	}
+
+	if pools > 0 && opts.conn.perConn > 0 {
+		infoLog.Printf("%d services share %d connections, up to %d resources per connection", totalServices, pools, opts.conn.perConn)
+	} else if pools > 0 {
+		infoLog.Printf("%d services share %d connections", totalServices, pools)
+	}
+	infoLog.Printf("")
+	infoLog.Printf("Press Ctrl+C to shutdown")
+	// currentInterval is the interval of the running services, which a
+	// reloaded config changes.
+	var currentInterval atomic.Int64
+	currentInterval.Store(int64(interval))
+	if opts.cardinality.growth > 0 {
+		go everyInterval(ctx, &currentInterval, func(time.Duration) {
+			infoLog.Printf("Total series %d", st.series.Load())
+		})
+	}
+	if opts.newSeries.perInterval > 0 {
+		go everyInterval(ctx, &currentInterval, func(interval time.Duration) {
+			n := st.newSeries.Swap(0)
+			infoLog.Printf("New series %d in the last %s, %.1f/s", n, interval, float64(n)/interval.Seconds())
+		})
+	}
+	if opts.burst.series > 0 {
+		go func() {
+			// The services start and end the bursts on their own at the
+			// same offsets from the start, this only logs them.
+			for n := 1; ; n++ {
+				burstStart := start.Add(time.Duration(n) * opts.burst.every)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(burstStart)):
+				}
+				infoLog.Printf("Burst %d started: %d new series, peak of %d series", n, opts.burst.series, st.series.Load()+int64(opts.burst.series))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(burstStart.Add(opts.burst.duration))):
+				}
+				infoLog.Printf("Burst %d ended: %d series dropped", n, opts.burst.series)
+			}
+		}()
+	}
+	// hup receives SIGHUP with -reload-on-sighup and is nil otherwise.
+	var hup chan os.Signal
+	if opts.reload {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-hup:
+		}
+		next, err := loadConfig(opts.configFiles, opts.configMerge)
+		if err != nil {
+			log.Printf("Failed to reload the config, keeping the running config: %v", err)
+			continue
+		}
+		changes, others, err := reloadChanges(loaded, next)
+		services := max(1, next.Services)
+		if err == nil && opts.requests > 0 && opts.requests < services {
+			err = fmt.Errorf("-requests-per-interval %d must be at least the number of services, %d", opts.requests, services)
+		}
+		if err != nil {
+			log.Printf("Invalid reloaded config, keeping the running config: %v", err)
+			continue
+		}
+		if others {
+			log.Printf("The reloaded config changes settings other than services and interval, restart firegen to apply them")
+		}
+		if len(changes) == 0 {
+			infoLog.Printf("Reloaded the config, services and interval unchanged")
+			continue
+		}
+		infoLog.Printf("Reloading the config: %s, restarting the services", strings.Join(changes, ", "))
+		stopServices()
+		wg.Wait()
+		if services != max(1, loaded.Services) {
+			// Without tenants, which keep the services, the services are
+			// those of the only tenant.
+			tenants[0].Services, totalServices = services, services
+			metricCounts = drawMetricCounts(cfg, services, opts.seed)
+			cardScales = drawCardScales(opts.cardinality.jitter, services, opts.seed)
+			totalSeries = 0
+			for s := range services {
+				metrics := tenantMetrics[0]
+				if metricCounts != nil {
+					metrics = metrics[:metricCounts[s]]
+				}
+				var cardScale float64
+				if cardScales != nil {
+					cardScale = cardScales[s]
+				}
+				totalSeries += serviceSeries(metrics, attrCardinality, cardScale)
+			}
+			if cfg.DuplicateScopeMetrics {
+				totalSeries *= cfg.Scopes
+			}
+			if opts.single {
+				collapsed, totalServices = services, 1
+				tenants[0].Services = 1
+			}
+			if transports != nil {
+				transports = cfg.assignTransports(totalServices)
+			}
+			if opts.conn.init != nil {
+				opts.conn.init = newExporterInit(opts.conn.initConc, totalServices)
+			}
+			if opts.scrape != nil {
+				opts.scrape.reset()
+			}
+		}
+		loaded.Services, loaded.Interval = next.Services, next.Interval
+		st.series.Store(int64(totalSeries))
+		servicesCtx, stopServices = context.WithCancel(ctx)
+		currentInterval.Store(int64(time.Duration(max(1, next.Interval)) * time.Second))
+		launchServices(servicesCtx, time.Duration(currentInterval.Load()))
+		infoLog.Printf("Restarted the services, total series %d", totalSeries)
+	}
+	wg.Wait()
+	interval = time.Duration(currentInterval.Load())
+	if opts.benchmark {
+		elapsed := time.Since(start)
+		exports, failures, points := st.exports.Load(), st.failures.Load(), st.points.Load()
+		infoLog.Printf("")
+		infoLog.Printf("Sent %d data points in %d exports over %s", points, exports, elapsed.Round(time.Millisecond))
+		infoLog.Printf("Throughput %.0f data points/s", float64(points)/elapsed.Seconds())
+		if exports > 0 {
+			infoLog.Printf("Failed exports %d (%.2f%%)", failures, 100*float64(failures)/float64(exports))
+		}
+		if skipped := st.skipped.Load(); skipped > 0 {
+			infoLog.Printf("Skipped empty exports %d", skipped)
+		}
+	}
+	if opts.requests > 0 {
+		elapsed := time.Since(start)
+		exports := st.exports.Load()
+		infoLog.Printf("")
+		infoLog.Printf("Sent %d requests over %s, %.1f requests/s of the %.1f targeted",
+			exports, elapsed.Round(time.Millisecond), float64(exports)/elapsed.Seconds(), float64(opts.requests)/interval.Seconds())
+	}
+	if changes := st.resourceChanges.Load(); changes > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Resource changes %d", changes)
+	}
+	if opts.churn.rate > 0 {
+		elapsed := time.Since(start)
+		churned := st.churned.Load()
+		infoLog.Printf("")
+		infoLog.Printf("Resource churn %d new resources over %s, %.2f per interval of the %g targeted",
+			churned, elapsed.Round(time.Millisecond), float64(churned)/(elapsed.Seconds()/interval.Seconds()), opts.churn.rate)
+	}
+	if reconnects := st.reconnects.Load(); reconnects > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Recreated exporters %d", reconnects)
+	}
+	if injected := st.injected.Load(); injected > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Injected failures %d", injected)
+	}
+	if flaps := st.flaps.Load(); flaps > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Flaps %d", flaps)
+	}
+	if opts.interceptors.chain != nil {
+		infoLog.Printf("")
+		if slices.Contains(opts.interceptors.chain.names, interceptorFail) {
+			infoLog.Printf("gRPC calls %d, failed by the %s interceptor %d", opts.interceptors.chain.calls.Load(), interceptorFail, opts.interceptors.chain.failed.Load())
+		} else {
+			infoLog.Printf("gRPC calls %d", opts.interceptors.chain.calls.Load())
+		}
+	}
+	if malformed := st.malformed.Load(); malformed > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Malformed export requests %d", malformed)
+	}
+	if opts.corrupt.corrupter != nil {
+		infoLog.Printf("")
+		infoLog.Printf("Corrupted export requests %d", opts.corrupt.corrupter.corrupted.Load())
+	}
+	if opts.rampStep > 0 {
+		accepted, rejected, err := opts.points.rewrite.ramp.result()
+		infoLog.Printf("")
+		if rejected > 0 {
+			infoLog.Printf("Payload ramp: largest accepted request %s (%d bytes), first rejected request %s (%d bytes): %v",
+				formatBytes(float64(accepted)), accepted, formatBytes(float64(rejected)), rejected, err)
+		} else {
+			infoLog.Printf("Payload ramp: largest accepted request %s (%d bytes), no request was rejected", formatBytes(float64(accepted)), accepted)
+		}
+	}
+	if overflowing := st.overflowing.Load(); overflowing > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Services over the cardinality limit %d", overflowing)
+	}
+	if nans := st.nans.Load(); nans > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Histogram NaN recordings %d, collected data points with a NaN sum %d", nans, st.nanSums.Load())
+	}
+	if duplicates := st.duplicates.Load(); duplicates > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Duplicated data points %d", duplicates)
+	}
+	if blocked, busy := st.blocked.Load(), st.busy.Load(); blocked > 0 || busy > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Exports that waited for an in-flight slot %d, skipped for lack of one %d", blocked, busy)
+	}
+	if lagging := st.lagging.Load(); lagging > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Ticks longer than the interval %d", lagging)
+	}
+	if failed := st.failedServices.Load(); failed > 0 {
+		infoLog.Printf("")
+		infoLog.Printf("Services stopped by an error %d", failed)
+	}
+	if allFailed.Load() {
+		log.Fatalf("All services failed")
+	}
+	infoLog.Printf("")
+	infoLog.Printf("Bye")
+}
+
+// logSeries logs the series of every tenant and returns their total.
+// metricCounts and cardScales are nil without a metrics range and
+// -cardinality-jitter.
+func (opts options) logSeries(cfg config, tenants []tenantConfig, tenantMetrics [][]metricConfig, metricCounts []int, cardScales []float64, attrCardinality int) int {
+	totalSeries := 0
+	first := 0
+	for i, tenant := range tenants {
+		perService := 0
+		for _, m := range tenantMetrics[i] {
+			if m.Attributes != nil {
+				perService += cardinality(m.Attributes)
+			} else {
+				perService += attrCardinality
+			}
+		}
+		if cfg.DuplicateScopeMetrics {
+			perService *= cfg.Scopes
+		}
+		series := tenant.Services * perService
+		// Without definitions every metric has the same number of series.
+		perMetric := perService / len(tenantMetrics[i])
+		if metricCounts != nil {
+			series = 0
+			for _, n := range metricCounts[first : first+tenant.Services] {
+				series += n * perMetric
+			}
+		}
+		// Jittered services are counted one by one, the rounding makes the
+		// total differ from the configured one.
+		lo, hi := math.MaxInt, 0
+		if cardScales != nil {
+			series = 0
+			for s := first; s < first+tenant.Services; s++ {
+				metrics := tenantMetrics[i]
+				if metricCounts != nil {
+					metrics = metrics[:metricCounts[s]]
+				}
+				n := serviceSeries(metrics, attrCardinality, cardScales[s])
+				if cfg.DuplicateScopeMetrics {
+					n *= cfg.Scopes
+				}
+				series += n
+				lo, hi = min(lo, n), max(hi, n)
+			}
+		}
+		if len(cfg.Tenants) > 0 && metricCounts != nil {
+			infoLog.Printf("Tenant %s: %d services, %d-%d metrics per service, %d series", tenant.Name, tenant.Services, cfg.MinMetrics, cfg.MaxMetrics, series)
+		} else if len(cfg.Tenants) > 0 {
+			infoLog.Printf("Tenant %s: %d services, %d metrics, %d series", tenant.Name, tenant.Services, len(tenantMetrics[i]), series)
+		} else if cardScales != nil {
+			infoLog.Printf("Series per service %d-%d, %d on average, jittered by up to %g%%", lo, hi, series/tenant.Services, opts.cardinality.jitter)
+		} else if metricCounts != nil {
+			infoLog.Printf("Series per service %d-%d, %d on average", cfg.MinMetrics*perMetric, cfg.MaxMetrics*perMetric, series/tenant.Services)
+		} else {
+			infoLog.Printf("Series per service %d", perService)
+		}
+		totalSeries += series
+		first += tenant.Services
+	}
+	return totalSeries
+}
+
+// logSettings logs the settings of the flags that are in effect.
+func (opts options) logSettings(cfg config, totalServices, resourceCardinality int, interval time.Duration) {
+	if opts.cardinality.growth > 0 {
+		if opts.cardinality.maxSeries > 0 {
+			infoLog.Printf("Growing by %d series per interval up to %d series", opts.cardinality.growth, opts.cardinality.maxSeries)
+		} else {
+			infoLog.Printf("Growing by %d series per interval", opts.cardinality.growth)
+		}
+	}
+	if opts.hourlyLoad != nil {
+		now := opts.clock.now()
+		infoLog.Printf("Hourly load schedule, recording %g of the series at %02d:00", opts.hourlyLoad[now.Hour()], now.Hour())
+	}
+	if opts.chaos.probability > 0 {
+		infoLog.Printf("Chaos: dropping exports with probability %g", opts.chaos.probability)
+	}
+	if opts.chaos.every > 0 {
+		infoLog.Printf("Chaos: dropping all exports for %s every %s", opts.chaos.duration, opts.chaos.every)
+	}
+	if opts.flap.fraction > 0 {
+		flapping := 0
+		for i := range totalServices {
+			if fractionService(i, opts.flap.fraction) {
+				flapping++
+			}
+		}
+		infoLog.Printf("Flapping %d services, up and down for %s on average", flapping, opts.flap.period)
+	}
+	if opts.corrupt.corrupter != nil {
+		infoLog.Printf("Corrupting export requests with probability %g, mode %s", opts.corrupt.probability, opts.corrupt.mode)
+	}
+	if opts.interceptors.chain != nil {
+		infoLog.Printf("gRPC interceptors %s", strings.Join(opts.interceptors.chain.names, ", "))
+	}
+	if opts.malformed.probability > 0 {
+		infoLog.Printf("Sending export requests without a %s with probability %g, the exports are invalid OTLP", opts.malformed.mode, opts.malformed.probability)
+	}
+	if opts.churn.rate > 0 {
+		infoLog.Printf("Resource churn %g new resources per interval across all services, changing %s", opts.churn.rate, opts.churn.key)
+	}
+	if opts.newSeries.perInterval > 0 {
+		infoLog.Printf("New series %d per interval, each recorded for %d intervals, %d at a time", opts.newSeries.perInterval, opts.newSeries.lifetime, opts.newSeries.perInterval*opts.newSeries.lifetime)
+	}
+	if opts.burst.series > 0 {
+		infoLog.Printf("Bursts of %d series for %s every %s", opts.burst.series, opts.burst.duration, opts.burst.every)
+	}
+	if opts.single {
+		infoLog.Printf("Single resource: %d services collapsed into %d scopes of service-0000", totalServices, totalServices*cfg.Scopes)
+	} else if len(cfg.ResourceAttributes) > 0 {
+		distinct := min(totalServices, resourceCardinality)
+		if opts.valueMode != valuesShared {
+			distinct = totalServices
+		}
+		infoLog.Printf("Distinct resources %d", distinct)
+	}
+	if opts.presence < 1 {
+		infoLog.Printf("Attribute presence %g", opts.presence)
+	}
+	if opts.negative > 0 {
+		infoLog.Printf("Injecting negative counter deltas with probability %g", opts.negative)
+	}
+	if opts.rampStep > 0 {
+		infoLog.Printf("Payload ramp: padding the exports by %s more every %s until a request is rejected", formatBytes(float64(opts.rampStep)), interval)
+	}
+	if opts.reader.mode == readerPeriodic {
+		infoLog.Printf("Exporting with the SDK's periodic reader every %s", opts.reader.every)
+	}
+	if opts.cardinality.limit > 0 {
+		infoLog.Printf("Limiting every instrument to %d series", opts.cardinality.limit)
+	}
+	if opts.points.duplicates > 0 {
+		infoLog.Printf("Duplicating data points with probability %g, the exports are invalid OTLP", opts.points.duplicates)
+	}
+	if opts.schemaClash {
+		infoLog.Printf("Merging resources with the conflicting schema URLs %s and %s", conflictingSchemaURL, detectedSchemaURL)
+	}
+	if opts.detect {
+		infoLog.Printf("Detecting host, OS and process resource attributes")
+	}
+	if opts.conflicting {
+		infoLog.Printf("Emitting conflicting metric types: odd services send every metric with a different type")
+	}
+	if opts.sequence {
+		infoLog.Printf("Loss-detection mode: every data point carries a firegen.seq attribute and is a series of its own")
+	}
+	if opts.delta.gauges {
+		infoLog.Printf("Exporting gauges as delta sums")
+	}
+	if opts.delta.fraction > 0 {
+		delta := 0
+		for i := range totalServices {
+			if fractionService(i, opts.delta.fraction) {
+				delta++
+			}
+		}
+		infoLog.Printf("Temporality of counters and histograms: %d services delta, %d cumulative", delta, totalServices-delta)
+	}
+	if opts.stale.fraction > 0 {
+		infoLog.Printf("Stale fraction %g, silent for %d intervals", opts.stale.fraction, opts.stale.intervals)
+	}
+	if opts.conn.initConc > 0 {
+		infoLog.Printf("Creating the exporters of up to %d services in parallel", opts.conn.initConc)
+	}
+	if opts.maxPoints > 0 || opts.requests > 0 {
+		if opts.maxPoints > 0 {
+			infoLog.Printf("At most %d data points per request", opts.maxPoints)
+		} else {
+			infoLog.Printf("Sending %d requests per interval, %.1f requests/s", opts.requests, float64(opts.requests)/interval.Seconds())
+		}
+		if opts.conn.parallelism > 1 {
+			infoLog.Printf("Up to %d parallel requests per service", opts.conn.parallelism)
+		}
+	}
+	if len(cfg.Entities) > 0 {
+		infoLog.Printf("Referencing %d entities from the resources", len(cfg.Entities))
+	}
+	if opts.points.rewrite != nil && opts.points.rewrite.flags != 0 {
+		infoLog.Printf("Setting data point flags %#x on %g of the data points", opts.points.rewrite.flags, opts.points.flagged)
+	}
+	if opts.points.order != orderSorted {
+		infoLog.Printf("Attribute order %s", opts.points.order)
+	}
+	if opts.metricOrder != metricOrderSDK {
+		infoLog.Printf("Metric order %s", opts.metricOrder)
+	}
+	if opts.inflight.max > 0 {
+		if opts.inflight.skipBusy {
+			infoLog.Printf("At most %d exports in flight, skipping exports while all are taken", opts.inflight.max)
+		} else {
+			infoLog.Printf("At most %d exports in flight, waiting for a free slot while all are taken", opts.inflight.max)
+		}
+	}
+	if opts.conn.launch > 0 {
+		infoLog.Printf("Launching a service every %s, all services running after %s", opts.conn.launch, opts.conn.launch*time.Duration(totalServices-1))
+	}
+	if opts.benchmark {
+		infoLog.Printf("Benchmark mode, exporting without waiting for the interval")
+	}
+	if opts.duration > 0 {
+		infoLog.Printf("Running for %s", opts.duration)
+	}
+	if opts.skew != 0 {
+		infoLog.Printf("Skewing timestamps by %s", opts.skew)
+	}
+	if !opts.clock.realTime() {
+		infoLog.Printf("Virtual clock: event time %s at start, running %gx", opts.clock.start.Format(time.RFC3339), opts.clock.speed)
+		if d, ok := opts.clock.catchUp(); ok {
+			infoLog.Printf("Virtual clock: event time reaches the wall clock after %s", d.Round(time.Second))
+		}
+	}
+	if opts.drift > 0 {
+		infoLog.Printf("Clock drift of up to ±%s per service", opts.drift)
+	}
+	if opts.replay {
+		infoLog.Printf("Replaying the first collected snapshot on every interval")
+	}
+	if opts.outFile != "" {
+		infoLog.Printf("Writing OTLP JSON to %s", opts.outFile)
+	}
+	if opts.scrape != nil {
+		infoLog.Printf("Serving Prometheus scrape endpoint on %s/metrics", opts.promAddr)
+	}
 }
 
-type options struct {
-	configFile string
-	endpoint   string
-	plaintext  bool
-	token      string
-	useHTTP    bool
-	username   string
-	password   string
-	timeout    time.Duration
+// serviceConfig is what a service generates its metrics from.
+type serviceConfig struct {
+	svc                service
+	scopes             [][]metricConfig
+	scopeAttrs         []attribute.KeyValue
+	attributes         [][]attribute.KeyValue
+	resourceAttributes []attributeConfig
+	resourceIndex      int
+	offset             time.Duration
+	interval           time.Duration
+	rng                *rand.Rand
+	output             *jsonlWriter
+	st                 *stats
+	opts               options
 }
 
-func (opts options) newExporter(ctx context.Context) (sdkmetric.Exporter, error) {
-	headers := make(map[string]string)
+// generate runs a service until ctx is done or the service fails.
+func generate(ctx context.Context, sc serviceConfig) error {
+	svc, opts, st := sc.svc, sc.opts, sc.st
+	scopes, interval, rng := sc.scopes, sc.interval, sc.rng
+	serviceName := svc.name
+	// stop stops the service with the first error of a tick, which may
+	// come from several -record-concurrency workers at once, and failure
+	// holds it for generate to return.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var failure error
+	var stopOnce sync.Once
+	stop := func(err error) {
+		stopOnce.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+	var exporters *serviceExporters
+	if opts.endpoint != "" && !opts.estimate {
+		exporters = opts.newServiceExporters(serviceName, st)
+		defer func() { exporters.shutdown(ctx) }()
+		err := opts.conn.init.run(ctx, func() error {
+			return exporters.open(ctx, opts.conn.parallelism)
+		})
+		if ctx.Err() != nil {
+			// Shut down while waiting to create the exporters.
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+	}
+	// orderRng shuffles the metrics with -metric-order shuffle, a stream of
+	// its own so the order does not change the values of the service.
+	orderRng := randv2.New(randv2.NewPCG(uint64(opts.seed), uint64(svc.index)))
+
+	selector := temporality
+	if opts.delta.enabled {
+		selector = deltaTemporality
+	} else if opts.delta.histograms {
+		selector = deltaHistogramTemporality
+	}
+	if opts.delta.gauges {
+		selector = withDeltaGauges(selector)
+	}
+	// newProvider creates a meter provider and its reader for the service
+	// with the given resource attributes.
+	// schemaLogged is set once the first -conflicting-schema-urls conflict
+	// is logged, a changing resource conflicts again.
+	schemaLogged := false
+	// changing is set if the resource attributes change, periodic is the
+	// exporter of the current periodic reader.
+	changing := slices.ContainsFunc(sc.resourceAttributes, attributeConfig.changes)
+	var periodic *periodicExporter
+	newProvider := func(resourceAttrs []attribute.KeyValue) (sdkmetric.Reader, *sdkmetric.MeterProvider, error) {
+		var resourceOpts []resource.Option
+		if opts.schemaClash {
+			resourceOpts = append(resourceOpts, schemaConflictOptions()...)
+		}
+		if opts.detect {
+			// resource.WithProcess would also add the command line arguments,
+			// which may contain -token or -password.
+			resourceOpts = append(resourceOpts,
+				resource.WithHost(),
+				resource.WithOS(),
+				resource.WithProcessPID(),
+				resource.WithProcessExecutableName(),
+				resource.WithProcessExecutablePath(),
+				resource.WithProcessOwner(),
+				resource.WithProcessRuntimeName(),
+				resource.WithProcessRuntimeVersion(),
+				resource.WithProcessRuntimeDescription(),
+			)
+		}
+		resourceOpts = append(resourceOpts,
+			resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
+			resource.WithAttributes(resourceAttrs...),
+		)
+		res, err := resource.New(ctx, resourceOpts...)
+		if opts.schemaClash && errors.Is(err, resource.ErrSchemaURLConflict) {
+			if !schemaLogged && svc.index == 0 {
+				schemaLogged = true
+				infoLog.Printf("Resource of %s has conflicting schema URLs, exporting it with the schema URL %q: %v", serviceName, res.SchemaURL(), err)
+			}
+			// The conflict is deliberate, failed detections are not.
+			if !errors.Is(err, resource.ErrPartialResource) {
+				err = nil
+			}
+		}
+		if errors.Is(err, resource.ErrPartialResource) {
+			log.Printf("Failed to detect some resource attributes for %s: %v", serviceName, err)
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to create resource: %w", err)
+		}
+		var reader sdkmetric.Reader = sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(selector))
+		if opts.reader.mode == readerPeriodic {
+			exporter := &periodicExporter{selector: selector, service: serviceName, output: sc.output, st: st, opts: opts,
+				order: randv2.New(randv2.NewPCG(uint64(opts.seed), uint64(svc.index))), carry: changing}
+			periodic = exporter
+			if exporters != nil {
+				exporter.exporter = exporters.exporters[0]
+			}
+			reader = sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(opts.reader.every), sdkmetric.WithTimeout(opts.timeout))
+		}
+		providerOpts := []sdkmetric.Option{sdkmetric.WithReader(reader), sdkmetric.WithResource(res)}
+		if opts.scrape != nil {
+			scrapeReader, err := opts.scrape.reader(serviceName)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+			}
+			providerOpts = append(providerOpts, sdkmetric.WithReader(scrapeReader))
+		}
+		return reader, sdkmetric.NewMeterProvider(providerOpts...), nil
+	}
+
+	// resourceIndexes are the value indexes of the resource attributes,
+	// advanced by the attributes that change over time, and generation
+	// numbers the resources of -resource-churn-rate.
+	resourceIndexes := attributeIndexes(sc.resourceAttributes, sc.resourceIndex)
+	generation := 0
+	resourceAttributes := func() []attribute.KeyValue {
+		attrs := indexedAttributes(sc.resourceAttributes, resourceIndexes, opts.valueMode, svc)
+		if opts.churn.rate > 0 {
+			attrs = append(attrs, attribute.String(opts.churn.key, fmt.Sprintf("%s-%06d", serviceName, generation)))
+		}
+		return attrs
+	}
+	reader, provider, err := newProvider(resourceAttributes())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if opts.reader.mode == readerPeriodic {
+			// Like an SDK shutting down, the periodic reader exports what
+			// was recorded since its last export.
+			provider.Shutdown(context.WithoutCancel(ctx))
+		} else {
+			provider.Shutdown(ctx)
+		}
+	}()
+
+	// instrument is a generated metric and the state of its series.
+	type instrument struct {
+		metricConfig
+		scope      string
+		record     recordFunc
+		attributes [][]attribute.KeyValue
+		// bucketValues fill each histogram bucket with the configured count.
+		bucketValues []float64
+		// observations is the number of values recorded per series and
+		// tick, several for histograms.
+		observations int
+		// walk holds the current value of each series for random walks,
+		// indexed by attribute combination.
+		walk []float64
+		// silent counts down the intervals each stale series skips,
+		// indexed by attribute combination.
+		silent []int
+		// program is the compiled value expression, if any.
+		program *vm.Program
+		// sample draws the values of the distribution, if any.
+		sample sampler
+		// last holds the previous value of each series for -delta-gauges,
+		// indexed by attribute combination.
+		last map[int]float64
+		// seq holds the next -sequence-numbers value of each series,
+		// indexed by attribute combination.
+		seq map[int]int64
+		// idle is set on the ticks the metric is not recorded on, following
+		// its emitProbability and lifetime.
+		idle bool
+		// ended is set while the metric is silent after its lifetime.
+		ended bool
+	}
+	var instruments []*instrument
+	// gauges are the instruments the -burst-series series are spread over.
+	var gauges []*instrument
+	for i, metrics := range scopes {
+		scopeName := "firegen-" + serviceName
+		if len(scopes) > 1 {
+			scopeName = fmt.Sprintf("%s-scope-%02d", scopeName, i)
+		}
+		for _, m := range metrics {
+			inst := &instrument{
+				metricConfig: m,
+				scope:        scopeName,
+				attributes:   sc.attributes,
+				bucketValues: m.bucketValues(),
+				observations: m.observations(),
+			}
+			if m.Attributes != nil {
+				inst.attributes = serviceAttributes(m.Attributes, opts.cardinality.scale, opts.valueMode, svc, opts.seed)
+			}
+			if m.Expr != "" {
+				program, err := compileExpr(m.Expr)
+				if err != nil {
+					return fmt.Errorf("failed to compile expr of metric %s: %w", m.Name, err)
+				}
+				inst.program = program
+			}
+			if m.Distribution != nil {
+				inst.sample = m.Distribution.sampler()
+			}
+			if m.Pattern == patternRandomWalk {
+				inst.walk = make([]float64, len(inst.attributes))
+				for k := range inst.walk {
+					inst.walk[k] = nextValue(rng, m.metricOptions, interval, nil)
+				}
+			}
+			if opts.sequence {
+				inst.seq = make(map[int]int64)
+			}
+			if opts.stale.fraction > 0 && cmp.Or(m.Type, metricGauge) == metricGauge {
+				inst.silent = make([]int, len(inst.attributes))
+			}
+			instruments = append(instruments, inst)
+			if cmp.Or(m.Type, metricGauge) == metricGauge {
+				gauges = append(gauges, inst)
+			}
+		}
+	}
+
+	// register creates the instruments with the current provider.
+	register := func() error {
+		for _, inst := range instruments {
+			meter := provider.Meter(inst.scope, metric.WithInstrumentationAttributes(sc.scopeAttrs...))
+			newRecord := newInstrument
+			if opts.delta.gauges && cmp.Or(inst.Type, metricGauge) == metricGauge {
+				newRecord = newDeltaGauge
+				inst.last = make(map[int]float64)
+			}
+			record, err := newRecord(meter, inst.metricConfig)
+			if err != nil {
+				return fmt.Errorf("failed to create metric %s: %w", inst.Name, err)
+			}
+			inst.record = record
+		}
+		return nil
+	}
+	if err := register(); err != nil {
+		return err
+	}
+
+	// carryTotals records the counter totals of the old resource on the
+	// instruments of the new one.
+	carryTotals := func(totals []counterTotal) {
+		if len(totals) == 0 {
+			return
+		}
+		type key struct{ scope, name string }
+		byName := make(map[key]*instrument, len(instruments))
+		for _, inst := range instruments {
+			byName[key{inst.scope, inst.Name}] = inst
+		}
+		for _, total := range totals {
+			if inst := byName[key{total.scope, total.name}]; inst != nil {
+				inst.record(ctx, total.value, metric.WithAttributeSet(total.attributes))
+			}
+		}
+	}
+
+	// changeResource advances the resource attributes that change on this
+	// tick and replaces the provider with one for the new resource. The
+	// series of the old resource end. A changed attribute, like a deploy
+	// changing the version, carries the counters over to the new resource,
+	// while churn replaces the instance like a restarted process.
+	ticks := 0
+	changeResource := func() {
+		n := ticks
+		ticks++
+		changed, churned := false, false
+		for i, c := range sc.resourceAttributes {
+			if c.ChangeEvery > 0 && n > 0 && n%c.ChangeEvery == 0 ||
+				c.ChangeProbability > 0 && rng.Float64() < c.ChangeProbability {
+				resourceIndexes[i] = (resourceIndexes[i] + 1) % c.Cardinality
+				changed = true
+			}
+		}
+		if k := churns(n, opts.churn.rate, opts.churn.phase); k > 0 {
+			generation += k
+			st.churned.Add(int64(k))
+			changed, churned = true, true
+		}
+		if !changed {
+			return
+		}
+		attrs := resourceAttributes()
+		var totals []counterTotal
+		if !churned && opts.reader.mode != readerPeriodic {
+			var metrics metricdata.ResourceMetrics
+			if err := reader.Collect(ctx, &metrics); err == nil {
+				totals = counterTotals(&metrics)
+			}
+		}
+		provider.Shutdown(ctx)
+		if !churned && periodic != nil {
+			// The shutdown flushed the final counter values.
+			periodic.mu.Lock()
+			totals = periodic.totals
+			periodic.mu.Unlock()
+		}
+		var err error
+		if reader, provider, err = newProvider(attrs); err == nil {
+			err = register()
+		}
+		if err != nil {
+			stop(err)
+			return
+		}
+		carryTotals(totals)
+		st.resourceChanges.Add(1)
+		set := attribute.NewSet(attrs...)
+		infoLog.Printf("Resource of %s changed to %s", serviceName, set.Encoded(attribute.DefaultEncoder()))
+	}
+
+	// terminating is set for the final tick of -terminate-with-value.
+	terminating := false
+
+	// tickElapsed is the event time since the previous tick, which is the
+	// interval only in real time: -benchmark ticks back to back and
+	// -clock-speed scales it. Rates add it so their slope holds between
+	// the exported timestamps.
+	tickElapsed, lastTick := interval, time.Time{}
+
+	// source is what a goroutine recording series draws its random values
+	// from.
+	type source struct {
+		rng *rand.Rand
+		env exprEnv
+	}
+	newSource := func(rng *rand.Rand) *source {
+		src := &source{rng: rng, env: newExprEnv(rng)}
+		src.env.Service = svc.index
+		return src
+	}
+	serviceSource := newSource(rng)
+	// sources has one source per -record-concurrency worker, seeded from
+	// the service's generator to keep runs reproducible.
+	var sources []*source
+	if opts.recorders > 1 {
+		for range min(opts.recorders, len(instruments)) {
+			sources = append(sources, newSource(rand.New(rand.NewSource(rng.Int63()))))
+		}
+	}
 
-	if opts.token != "" {
-		headers["authorization"] = "Bearer " + opts.token
-	} else if opts.username != "" && opts.password != "" {
-		auth := base64.StdEncoding.EncodeToString([]byte(opts.username + ":" + opts.password))
-		headers["authorization"] = "Basic " + auth
+	// observe records the measurements of series k for a tick.
+	observe := func(src *source, inst *instrument, k int, attributes []attribute.KeyValue, state *float64) {
+		if inst.seq != nil {
+			attributes = append(slices.Clip(attributes), attribute.Int64("firegen.seq", inst.seq[k]))
+			inst.seq[k]++
+		}
+		opt := metric.WithAttributes(attributes...)
+		if inst.BucketCounts != nil {
+			for _, value := range inst.bucketValues {
+				inst.record(ctx, nanValue(src.rng, inst.NaNFraction, value, st), opt)
+			}
+			return
+		}
+		for range inst.observations {
+			var value float64
+			if terminating {
+				value = *opts.terminate
+			} else if inst.program != nil {
+				src.env.T, src.env.Series = time.Since(opts.start).Seconds(), k
+				v, err := evalExpr(inst.program, src.env)
+				if err != nil {
+					stop(fmt.Errorf("failed to evaluate expr of metric %s: %w", inst.Name, err))
+					return
+				}
+				value = inst.quantize(v)
+			} else if inst.sample != nil {
+				// With the virtual clock the elapsed time is that of the
+				// timestamps, so the waves line up with them.
+				at := seriesClock{opts.clock.now().Sub(opts.clock.at(opts.start)), svc.index, k}
+				value = inst.quantize(inst.sample(src.rng, at))
+			} else {
+				value = inst.quantize(nextValue(src.rng, inst.metricOptions, tickElapsed, state))
+			}
+			if opts.negative > 0 && inst.Type == metricCounter && src.rng.Float64() < opts.negative {
+				value = -value
+			}
+			if inst.last != nil {
+				value, inst.last[k] = value-inst.last[k], value
+			}
+			inst.record(ctx, nanValue(src.rng, inst.NaNFraction, value, st), opt)
+		}
 	}
 
-	if opts.useHTTP {
-		httpOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(opts.endpoint)}
-		if opts.plaintext {
-			httpOpts = append(httpOpts, otlpmetrichttp.WithInsecure())
+	// recordSeries records the configured series of an instrument for a
+	// tick, the first load fraction of them following hourlyLoad.
+	recordSeries := func(src *source, inst *instrument, load float64) {
+		inst.idle = inst.ended
+		if p := inst.EmitProbability; p != nil && !inst.ended {
+			inst.idle = src.rng.Float64() >= *p
+		}
+		if inst.idle {
+			return
 		}
-		if len(headers) > 0 {
-			httpOpts = append(httpOpts, otlpmetrichttp.WithHeaders(headers))
+		// The load schedule records the first combinations of every
+		// metric, so the same series come and go every day.
+		active := int(math.Round(load * float64(len(inst.attributes))))
+		for k, attributes := range inst.attributes[:active] {
+			if inst.silent != nil {
+				if inst.silent[k] > 0 {
+					inst.silent[k]--
+					continue
+				} else if src.rng.Float64() < opts.stale.fraction {
+					inst.silent[k] = opts.stale.intervals
+					inst.record(ctx, staleNaN, metric.WithAttributes(attributes...))
+					continue
+				}
+			}
+			if opts.presence < 1 && src.rng.Float64() >= opts.presence {
+				continue
+			}
+			var state *float64
+			if inst.walk != nil {
+				state = &inst.walk[k]
+			}
+			observe(src, inst, k, emptyAttributes(omitAttributes(attributes, opts.optional, src.rng), opts.empty, src.rng), state)
 		}
-		return otlpmetrichttp.New(ctx, httpOpts...)
 	}
 
-	grpcOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(opts.endpoint)}
-	if opts.plaintext {
-		grpcOpts = append(grpcOpts, otlpmetricgrpc.WithTLSCredentials(insecure.NewCredentials()))
+	// grown holds the series added by -cardinality-growth, spread
+	// round-robin over the instruments.
+	type series struct {
+		instrument *instrument
+		attributes []attribute.KeyValue
+		// walk is the current value of a random walk series.
+		walk *float64
 	}
-	if len(headers) > 0 {
-		grpcOpts = append(grpcOpts, otlpmetricgrpc.WithHeaders(headers))
+	// newSeries returns an added series of inst, which starts its random
+	// walk at a random value like the configured series.
+	newSeries := func(inst *instrument, attributes []attribute.KeyValue) series {
+		s := series{instrument: inst, attributes: attributes}
+		if inst.walk != nil {
+			s.walk = new(float64)
+			*s.walk = nextValue(rng, inst.metricOptions, interval, nil)
+		}
+		return s
 	}
-	return otlpmetricgrpc.New(ctx, grpcOpts...)
-}
-
-func main() {
-	var opts options
-	flag.StringVar(&opts.configFile, "config", "firegen.yaml", "Path to config file")
-	flag.StringVar(&opts.endpoint, "endpoint", "localhost:4317", "OTLP endpoint")
-	flag.BoolVar(&opts.plaintext, "plaintext", false, "Use plaintext connection instead of TLS")
-	flag.StringVar(&opts.token, "token", "", "Bearer token for authentication")
-	flag.StringVar(&opts.username, "username", "", "Username for Basic authentication")
-	flag.StringVar(&opts.password, "password", "", "Password for Basic authentication")
-	flag.BoolVar(&opts.useHTTP, "http", false, "Use HTTP instead of gRPC")
-	flag.DurationVar(&opts.timeout, "timeout", 1*time.Second, "Request timeout")
-	flag.Parse()
+	var grown []series
 
-	var cfg config
-	if f, err := os.Open(opts.configFile); err != nil {
-		log.Fatalf("Failed to open %s: %v", opts.configFile, err)
-	} else if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
-		log.Fatalf("Failed to parse %s: %v", opts.configFile, err)
+	// burst holds the series of the current -burst-series burst, and
+	// bursts the number of the burst. They are gauges, which are no longer
+	// exported once they are no longer recorded, and have negative series
+	// indexes to keep them apart from the configured and grown series.
+	var burst []series
+	bursts := 0
+	endBurst := func() {
+		for b, s := range burst {
+			delete(s.instrument.last, -1-b)
+			delete(s.instrument.seq, -1-b)
+		}
+		burst = nil
 	}
-	cfg.Metrics = max(1, cfg.Metrics)
-	cfg.Interval = max(1, cfg.Interval)
-	cfg.Services = max(1, cfg.Services)
-	for i := range cfg.Attributes {
-		cfg.Attributes[i].Cardinality = max(1, cfg.Attributes[i].Cardinality)
+	// updateBurst starts and ends the bursts, at the same offsets from the
+	// start in every service.
+	updateBurst := func() {
+		if opts.burst.series == 0 || len(gauges) == 0 {
+			return
+		}
+		n, ok := scheduleWindow(time.Since(opts.start), opts.burst.every, opts.burst.duration)
+		if !ok {
+			endBurst()
+			return
+		}
+		if n == bursts {
+			return
+		}
+		endBurst()
+		bursts = n
+		for b := range opts.burst.series {
+			burst = append(burst, newSeries(gauges[b%len(gauges)],
+				[]attribute.KeyValue{attribute.String("firegen.burst", fmt.Sprintf("%d-%09d", n, b))}))
+		}
 	}
-	interval := time.Duration(cfg.Interval) * time.Second
-
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
 
-	metricNames := slices.Collect(func(yield func(string) bool) {
-		for i := range cfg.Metrics {
-			yield(fmt.Sprintf("metric-%04d", i))
+	// churn holds the series of -new-series-per-interval, a ring in which
+	// every tick replaces the oldest newSeries series with new ones, so each
+	// lives for newFor ticks. They are gauges like the bursts, with indexes
+	// below those of the bursts, and created numbers them.
+	churn := make([]series, opts.newSeries.perInterval*opts.newSeries.lifetime)
+	created := 0
+	updateChurn := func() {
+		if len(churn) == 0 || len(gauges) == 0 {
+			return
 		}
-	})
-	allAttributes := slices.Collect(iterateAttributes(cfg.Attributes))
-
-	attrCardinality := 1
-	for _, attrConfig := range cfg.Attributes {
-		attrCardinality *= attrConfig.Cardinality
-	}
-
-	log.Printf("Generating %d services, %d metrics, %d attributes", cfg.Services, cfg.Metrics, len(cfg.Attributes))
-	log.Printf("Interval %s", interval)
-	log.Printf("")
-	log.Printf("Attribute cardinality per metric %d", attrCardinality)
-	log.Printf("Series per service %d", cfg.Metrics*attrCardinality)
-	log.Printf("Total series %d", cfg.Services*cfg.Metrics*attrCardinality)
-
-	for i := range cfg.Services {
-		serviceName := fmt.Sprintf("service-%04d", i)
-		offset := time.Duration(float32(interval) * float32(i) / float32(cfg.Services))
-		go generate(ctx, serviceName, metricNames, allAttributes, offset, interval, opts)
-	}
-
-	log.Printf("")
-	log.Printf("Press Ctrl+C to shutdown")
-	<-ctx.Done()
-	log.Printf("")
-	log.Printf("Bye")
-}
-
-func generate(
-	ctx context.Context,
-	serviceName string,
-	metricNames []string,
-	allAttributes [][]attribute.KeyValue,
-	offset, interval time.Duration,
-	opts options,
-) {
-	exporter, err := opts.newExporter(ctx)
-	if err != nil {
-		log.Fatalf("Failed to create OTLP exporter for service %s: %v", serviceName, err)
+		for range opts.newSeries.perInterval {
+			slot := created % len(churn)
+			if old := churn[slot].instrument; old != nil {
+				delete(old.last, -1-opts.burst.series-slot)
+				delete(old.seq, -1-opts.burst.series-slot)
+			}
+			churn[slot] = newSeries(gauges[created%len(gauges)],
+				[]attribute.KeyValue{attribute.String("firegen.churn", fmt.Sprintf("%012d", created))})
+			created++
+		}
+		st.newSeries.Add(int64(opts.newSeries.perInterval))
 	}
-	defer exporter.Shutdown(ctx)
 
-	res, err := resource.New(ctx,
-		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
-	)
-	if err != nil {
-		log.Fatalf("Failed to create resource for %s: %v", serviceName, err)
+	// terminate records the -terminate-with-value sentinel for every gauge
+	// series on the final tick.
+	terminate := func() {
+		for _, inst := range instruments {
+			if cmp.Or(inst.Type, metricGauge) != metricGauge {
+				continue
+			}
+			for k, attributes := range inst.attributes {
+				observe(serviceSource, inst, k, attributes, nil)
+			}
+		}
+		for g, s := range grown {
+			if cmp.Or(s.instrument.Type, metricGauge) == metricGauge {
+				observe(serviceSource, s.instrument, len(s.instrument.attributes)+g/len(instruments), s.attributes, nil)
+			}
+		}
+		for b, s := range burst {
+			observe(serviceSource, s.instrument, -1-b, s.attributes, nil)
+		}
+		for c, s := range churn {
+			if s.instrument != nil {
+				observe(serviceSource, s.instrument, -1-opts.burst.series-c, s.attributes, nil)
+			}
+		}
 	}
 
-	reader := sdkmetric.NewManualReader()
-	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
-	defer provider.Shutdown(ctx)
+	// ended holds the names of the metrics that are silent after their
+	// lifetime on the current tick.
+	ended := map[string]bool{}
+	lifetimes := slices.ContainsFunc(instruments, func(inst *instrument) bool { return inst.Lifetime > 0 })
 
-	meter := provider.Meter("firegen-" + serviceName)
-	gauges := make([]metric.Float64Gauge, len(metricNames))
-	for i, metricName := range metricNames {
-		gauge, err := meter.Float64Gauge(metricName)
-		if err != nil {
-			log.Fatalf("Failed to create gauge metric %s for %s: %v", metricName, serviceName, err)
-		}
-		gauges[i] = gauge
-	}
+	// snapshot holds the first collection in replay mode, re-exported with
+	// its original values and timestamps on every later tick.
+	var snapshot *metricdata.ResourceMetrics
+	// overflowing is whether the service has hit the cardinality limit.
+	overflowing := false
 
 	tick := func() {
-		// Step 1: record metrics
-		for _, gauge := range gauges {
-			for _, attributes := range allAttributes {
-				gauge.Record(ctx, rand.Float64(), metric.WithAttributes(attributes...))
+		var metrics metricdata.ResourceMetrics
+		if snapshot != nil {
+			metrics = *snapshot
+		} else {
+			if terminating {
+				terminate()
+			} else {
+				changeResource()
+
+				// Step 1: record metrics
+				now := opts.clock.now()
+				if !lastTick.IsZero() {
+					tickElapsed = now.Sub(lastTick)
+				}
+				lastTick = now
+				load := 1.0
+				if opts.hourlyLoad != nil {
+					load = opts.hourlyLoad[now.Hour()]
+				}
+				if lifetimes {
+					elapsed := time.Since(opts.start)
+					clear(ended)
+					for _, inst := range instruments {
+						if inst.ended = !inst.emitting(elapsed); inst.ended {
+							ended[inst.Name] = true
+						}
+					}
+				}
+				if len(sources) > 1 {
+					// Worker w records instruments w, w+workers, ..., so
+					// the state of every instrument has a single writer.
+					var wg sync.WaitGroup
+					for w, src := range sources {
+						wg.Go(func() {
+							for i := w; i < len(instruments); i += len(sources) {
+								recordSeries(src, instruments[i], load)
+							}
+						})
+					}
+					wg.Wait()
+				} else {
+					for _, inst := range instruments {
+						recordSeries(serviceSource, inst, load)
+					}
+				}
+				for range opts.cardinality.growth {
+					if n := st.series.Add(1); opts.cardinality.maxSeries > 0 && n > int64(opts.cardinality.maxSeries) {
+						st.series.Add(-1)
+						break
+					}
+					g := len(grown)
+					grown = append(grown, newSeries(instruments[g%len(instruments)],
+						[]attribute.KeyValue{attribute.String("firegen.series", fmt.Sprintf("%09d", g/len(instruments)))}))
+				}
+				for g, s := range grown {
+					if s.instrument.idle {
+						continue
+					}
+					observe(serviceSource, s.instrument, len(s.instrument.attributes)+g/len(instruments), s.attributes, s.walk)
+				}
+				updateBurst()
+				for b, s := range burst {
+					if s.instrument.idle {
+						continue
+					}
+					observe(serviceSource, s.instrument, -1-b, s.attributes, s.walk)
+				}
+				updateChurn()
+				for c, s := range churn {
+					if s.instrument == nil || s.instrument.idle {
+						continue
+					}
+					observe(serviceSource, s.instrument, -1-opts.burst.series-c, s.attributes, s.walk)
+				}
 			}
-		}
 
-		// Step 2: collect metrics
-		var metrics metricdata.ResourceMetrics
-		if err := reader.Collect(ctx, &metrics); err != nil {
-			log.Fatalf("Failed to collect metrics for %s: %v", serviceName, err)
+			// The periodic reader collects and exports on its own schedule.
+			if opts.reader.mode == readerPeriodic {
+				return
+			}
+
+			// Step 2: collect metrics
+			if err := reader.Collect(ctx, &metrics); ctx.Err() != nil {
+				return
+			} else if err != nil {
+				stop(fmt.Errorf("failed to collect metrics: %w", err))
+				return
+			}
+			if len(ended) > 0 {
+				// Cumulative sums and histograms keep their last state, so
+				// the metrics after their lifetime are left out of the
+				// collection as well as not recorded.
+				dropMetrics(&metrics, ended)
+			}
+			if !opts.clock.realTime() {
+				mapTimestamps(&metrics, opts.clock.at)
+			}
+			if opts.skew != 0 {
+				skewTimestamps(&metrics, opts.skew)
+			}
+			if opts.metricOrder != metricOrderSDK {
+				orderMetrics(&metrics, opts.metricOrder, orderRng)
+			}
+			if opts.cardinality.limit > 0 && !overflowing {
+				if n := overflowMetrics(&metrics); n > 0 {
+					overflowing = true
+					st.overflowing.Add(1)
+					log.Printf("Service %s hit the cardinality limit of %d series in %d metrics, further series are aggregated into otel.metric.overflow", serviceName, opts.cardinality.limit, n)
+				}
+			}
+			if st.nans.Load() > 0 {
+				st.nanSums.Add(int64(nanSums(&metrics)))
+			}
+			if opts.points.duplicates > 0 {
+				st.duplicates.Add(int64(duplicateDataPoints(&metrics, opts.points.duplicates, rng)))
+			}
+			if opts.replay {
+				snapshot = &metrics
+			}
 		}
 
 		// Step 3: export metrics
-		exportCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+		if opts.estimate {
+			size, compressed, err := exportSize(&metrics)
+			if err != nil {
+				stop(fmt.Errorf("failed to estimate the export size: %w", err))
+				return
+			}
+			st.bytes.Add(int64(size))
+			st.compressed.Add(int64(compressed))
+			return
+		}
+		points := countDataPoints(&metrics)
+		if opts.skipEmpty && points == 0 {
+			st.skipped.Add(1)
+			if !opts.benchmark {
+				infoLog.Printf("Skipped empty export for %s", serviceName)
+			}
+			return
+		}
+		// Injected failures drop the export entirely, so firegen looks like
+		// a producer that stopped sending.
+		_, outage := scheduleWindow(time.Since(opts.start), opts.chaos.every, opts.chaos.duration)
+		if outage || opts.chaos.probability > 0 && rng.Float64() < opts.chaos.probability {
+			st.injected.Add(1)
+			if !opts.benchmark {
+				log.Printf("Chaos: injected failure, dropped export of %s", serviceName)
+			}
+			return
+		}
+		if sc.output != nil {
+			if err := sc.output.Write(&metrics); err != nil {
+				log.Printf("Failed to write metrics for %s to %s: %v", serviceName, opts.outFile, err)
+			}
+		}
+		if exporters == nil {
+			st.exports.Add(1)
+			st.points.Add(int64(points))
+			return
+		}
+		// Each chunk is exported in a request of its own and counts as a
+		// separate export. The results are counted once all are done.
+		chunks := opts.splitExport(&metrics)
+		if opts.malformed.probability > 0 {
+			for c := range chunks {
+				if rng.Float64() < opts.malformed.probability {
+					chunks[c] = malformMetrics(chunks[c], opts.malformed.mode)
+					st.malformed.Add(1)
+				}
+			}
+		}
 		t := time.Now()
-		err = exporter.Export(exportCtx, &metrics)
+		errs := exporters.export(ctx, chunks)
 		td := time.Since(t)
-		cancel()
-		if errors.Is(err, context.DeadlineExceeded) {
-			log.Printf("Timeout after %s exporting metrics for %s", opts.timeout, serviceName)
-		} else if ctx.Err() != nil {
+		if ctx.Err() != nil {
 			return
-		} else if err != nil {
-			log.Printf("Failed to export metrics for %s: %v", serviceName, err)
-		} else {
-			log.Printf("Exported %d measurements for %s in %dms", len(gauges), serviceName, td.Milliseconds())
+		}
+		failed, busy := false, false
+		for c, chunk := range chunks {
+			err := errs[c]
+			if errors.Is(err, errBusy) {
+				busy = true
+				continue
+			}
+			st.exports.Add(1)
+			if errors.Is(err, context.DeadlineExceeded) {
+				st.failures.Add(1)
+				failed = true
+				log.Printf("Timeout after %s exporting metrics for %s", opts.timeout, serviceName)
+			} else if err != nil {
+				st.failures.Add(1)
+				failed = true
+				log.Printf("Failed to export metrics for %s: %v", serviceName, err)
+			} else {
+				st.points.Add(int64(countDataPoints(chunk)))
+			}
+			exporters.result(ctx, err)
+		}
+		if busy && !opts.benchmark {
+			infoLog.Printf("Skipped export for %s: all %d in-flight slots taken", serviceName, opts.inflight.max)
+		}
+		if !failed && !busy && !opts.benchmark {
+			if len(chunks) > 1 {
+				infoLog.Printf("Exported %d measurements for %s in %d requests in %dms", len(instruments), serviceName, len(chunks), td.Milliseconds())
+			} else {
+				infoLog.Printf("Exported %d measurements for %s in %dms", len(instruments), serviceName, td.Milliseconds())
+			}
+		}
+	}
+
+	if opts.estimate {
+		tick()
+		return failure
+	}
+	if opts.benchmark {
+		for ctx.Err() == nil {
+			tick()
+		}
+		return failure
+	}
+
+	// timedTick reports ticks that take longer than the interval. The ticker
+	// drops the ticks missed in the meantime, so such a service exports less
+	// often than configured.
+	var flap *flapper
+	if opts.flap.enabled {
+		flap = newFlapper(opts.flap.period, opts.seed, svc.index, time.Now())
+	}
+	timedTick := func() {
+		t := time.Now()
+		if flap != nil {
+			down, changed, lasted := flap.at(t)
+			if changed && down {
+				st.flaps.Add(1)
+				infoLog.Printf("Flap: service %s went down after %s up", serviceName, lasted.Round(time.Millisecond))
+			} else if changed {
+				infoLog.Printf("Flap: service %s came back after %s down", serviceName, lasted.Round(time.Millisecond))
+			}
+			if down {
+				return
+			}
+		}
+		tick()
+		if lag := time.Since(t) - interval; lag > 0 && ctx.Err() == nil {
+			st.lagging.Add(1)
+			log.Printf("Service %s is falling behind: tick took %s longer than the %s interval", serviceName, lag.Round(time.Millisecond), interval)
 		}
 	}
 
-	time.Sleep(offset)
-	tick()
+	time.Sleep(sc.offset)
+	timedTick()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	for {
+		select {
+		case <-ctx.Done():
+			if opts.terminate != nil && failure == nil {
+				// The final tick outlives the shutdown, its export is
+				// still bounded by the timeout.
+				ctx = context.WithoutCancel(ctx)
+				terminating = true
+				tick()
+			}
+			return failure
+		case <-ticker.C:
+			timedTick()
+		}
+	}
+}
+
+// scopeMetrics assigns the metrics to n instrumentation scopes. The metrics
+// are spread round-robin so that each name is unique within the service, or
+// with duplicate every scope gets all metrics.
+func scopeMetrics[T any](metrics []T, n int, duplicate bool) [][]T {
+	scopes := make([][]T, n)
+	for i, m := range metrics {
+		if duplicate {
+			for s := range scopes {
+				scopes[s] = append(scopes[s], m)
+			}
+		} else {
+			scopes[i%n] = append(scopes[i%n], m)
+		}
+	}
+	return scopes
+}
+
+// everyInterval calls f with the interval once per interval until ctx is
+// done. The interval is read again after every call, so a reloaded
+// interval takes effect from the next one.
+func everyInterval(ctx context.Context, interval *atomic.Int64, f func(interval time.Duration)) {
+	d := time.Duration(interval.Load())
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		f(d)
+		if next := time.Duration(interval.Load()); next != d {
+			d = next
+			ticker.Reset(d)
+		}
+	}
+}
+
+// heartbeat logs the status of the run every interval until ctx is done,
+// with the standard logger so that it shows that firegen is alive during
+// long runs with -quiet. The error rate covers the exports since the
+// previous heartbeat.
+func heartbeat(ctx context.Context, start time.Time, interval time.Duration, st *stats) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastExports, lastFailures int64
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			tick()
+		}
+		exports, failures := st.exports.Load(), st.failures.Load()
+		rate := 0.0
+		if n := exports - lastExports; n > 0 {
+			rate = 100 * float64(failures-lastFailures) / float64(n)
+		}
+		log.Printf("Heartbeat: up %s, %d services running, %d exports, %.2f%% failed in the last %s",
+			time.Since(start).Round(time.Second), st.services.Load(), exports, rate, interval)
+		lastExports, lastFailures = exports, failures
+	}
+}
+
+// collapsedScopes returns the scopes of service i, with -single-resource
+// those of services i, ..., i+collapsed-1, the services collapsed into it.
+// With conflicting, the odd services have the conflicting types. scopes
+// returns the scopes of service c and their conflicting types.
+func collapsedScopes(i, collapsed int, conflicting bool, scopes func(c int) (scopes, conflicting [][]metricConfig)) [][]metricConfig {
+	var serviceScopes [][]metricConfig
+	for c := i; c < i+collapsed; c++ {
+		scopes, conflictingScopes := scopes(c)
+		if conflicting && c%2 == 1 {
+			serviceScopes = append(serviceScopes, conflictingScopes...)
+		} else {
+			serviceScopes = append(serviceScopes, scopes...)
+		}
+	}
+	return serviceScopes
+}
+
+// splitScopes assigns the metrics to n scopes like scopeMetrics, and also
+// returns the scopes with the conflicting types of -conflicting-types.
+func splitScopes(metrics []metricConfig, n int, duplicate bool) (scopes, conflicting [][]metricConfig) {
+	scopes = scopeMetrics(metrics, n, duplicate)
+	conflicting = make([][]metricConfig, len(scopes))
+	for s, metrics := range scopes {
+		for _, m := range metrics {
+			m.metricOptions = m.conflicting()
+			conflicting[s] = append(conflicting[s], m)
+		}
+	}
+	return scopes, conflicting
+}
+
+// temporality selects delta temporality for gauges so that each collection
+// only contains the series recorded since the previous one. With cumulative
+// temporality the SDK keeps reporting the last value of every series ever
+// recorded, which would hide the gaps of series that were skipped.
+func temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	if kind == sdkmetric.InstrumentKindGauge {
+		return metricdata.DeltaTemporality
+	}
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+// deltaHistogramTemporality is temporality with delta histograms, so that
+// the bucket counts, min and max of each data point only cover the
+// measurements of one interval.
+func deltaHistogramTemporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	if kind == sdkmetric.InstrumentKindHistogram {
+		return metricdata.DeltaTemporality
+	}
+	return temporality(kind)
+}
+
+// deltaTemporality is temporality with delta counters and histograms, the
+// temporalities the OTLP exporters pick with a delta preference: up-down
+// counters stay cumulative.
+func deltaTemporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindObservableCounter, sdkmetric.InstrumentKindHistogram:
+		return metricdata.DeltaTemporality
+	}
+	return temporality(kind)
+}
+
+// churns returns the number of -resource-churn-rate changes of a service on
+// tick n, for its rate of changes per interval. The changes of the first n
+// ticks are n×rate+phase rounded down, so a phase in [0, 1) shifts the
+// changes of the services against each other; the first tick has none.
+func churns(n int, rate, phase float64) int {
+	if n == 0 || rate <= 0 {
+		return 0
+	}
+	return int(math.Floor(float64(n)*rate+phase) - math.Floor(float64(n-1)*rate+phase))
+}
+
+// fractionService reports whether the service with index i is one of a
+// fraction of the services, such as those exporting with deltaTemporality
+// for -delta-fraction. The services are spread evenly over the indexes,
+// the first n services include n×fraction rounded down of them.
+func fractionService(i int, fraction float64) bool {
+	return math.Floor(float64(i+1)*fraction) > math.Floor(float64(i)*fraction)
+}
+
+// scheduleWindow returns the number of the scheduled window at elapsed since
+// the start, and whether elapsed is inside it. The windows last d and start
+// every period, the first one period after the start. A zero period has no
+// windows.
+func scheduleWindow(elapsed, every, d time.Duration) (int, bool) {
+	if every <= 0 {
+		return 0, false
+	}
+	n := int(elapsed / every)
+	return n, n > 0 && elapsed-time.Duration(n)*every < d
+}
+
+// withDeltaGauges returns selector with delta temporality for the up-down
+// counters that -delta-gauges records gauges with.
+func withDeltaGauges(selector sdkmetric.TemporalitySelector) sdkmetric.TemporalitySelector {
+	return func(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+		if kind == sdkmetric.InstrumentKindUpDownCounter {
+			return metricdata.DeltaTemporality
+		}
+		return selector(kind)
+	}
+}
+
+// counterTotal is the value of a cumulative sum series.
+type counterTotal struct {
+	scope, name string
+	attributes  attribute.Set
+	value       float64
+}
+
+// counterTotals returns the cumulative sum series of rm, which a resource
+// change carries over to the new meter provider. The overflow series of
+// -cardinality-limit are left out, the new provider aggregates them again.
+func counterTotals(rm *metricdata.ResourceMetrics) []counterTotal {
+	var totals []counterTotal
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[float64])
+			if !ok || sum.Temporality != metricdata.CumulativeTemporality {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				if dp.Attributes.HasValue(overflowKey) {
+					continue
+				}
+				totals = append(totals, counterTotal{sm.Scope.Name, m.Name, dp.Attributes, dp.Value})
+			}
 		}
 	}
+	return totals
 }
 
-func iterateAttributes(attrConfigs []attributeConfig) iter.Seq[[]attribute.KeyValue] {
+// staleNaN is the Prometheus staleness marker, a NaN with a specific bit
+// pattern that marks the end of a series.
+var staleNaN = math.Float64frombits(0x7ff0000000000002)
+
+// recordFunc records a single measurement on an instrument.
+type recordFunc func(ctx context.Context, value float64, opt metric.MeasurementOption)
+
+func newInstrument(meter metric.Meter, m metricConfig) (recordFunc, error) {
+	unit, description := metric.WithUnit(m.Unit), metric.WithDescription(m.Description)
+	switch m.Type {
+	case metricCounter:
+		counter, err := meter.Float64Counter(m.Name, unit, description)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, value float64, opt metric.MeasurementOption) {
+			counter.Add(ctx, value, opt)
+		}, nil
+	case metricUpDownCounter:
+		counter, err := meter.Float64UpDownCounter(m.Name, unit, description)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, value float64, opt metric.MeasurementOption) {
+			counter.Add(ctx, value, opt)
+		}, nil
+	case metricHistogram:
+		histogramOpts := []metric.Float64HistogramOption{unit, description}
+		if len(m.Buckets) > 0 {
+			histogramOpts = append(histogramOpts, metric.WithExplicitBucketBoundaries(m.Buckets...))
+		}
+		histogram, err := meter.Float64Histogram(m.Name, histogramOpts...)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, value float64, opt metric.MeasurementOption) {
+			histogram.Record(ctx, value, opt)
+		}, nil
+	default:
+		gauge, err := meter.Float64Gauge(m.Name, unit, description)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, value float64, opt metric.MeasurementOption) {
+			gauge.Record(ctx, value, opt)
+		}, nil
+	}
+}
+
+// newDeltaGauge creates a gauge for -delta-gauges as an up-down counter. The
+// caller records the change of the gauge since the previous measurement, so
+// with delta temporality the exported sums are the differences between
+// consecutive gauge values, and their running total is the gauge.
+func newDeltaGauge(meter metric.Meter, m metricConfig) (recordFunc, error) {
+	counter, err := meter.Float64UpDownCounter(m.Name, metric.WithUnit(m.Unit), metric.WithDescription(m.Description))
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, value float64, opt metric.MeasurementOption) {
+		counter.Add(ctx, value, opt)
+	}, nil
+}
+
+// serviceSeries returns the series of a service with the metrics and the
+// -cardinality-jitter scale in a single scope.
+func serviceSeries(metrics []metricConfig, attrCardinality int, scale float64) int {
+	n := 0
+	for _, m := range metrics {
+		if m.Attributes != nil {
+			n += jitteredCount(cardinality(m.Attributes), scale)
+		} else {
+			n += jitteredCount(attrCardinality, scale)
+		}
+	}
+	return n
+}
+
+// drawMetricCounts returns the number of metrics of each of the services
+// with a metrics range, nil without one. The count of a service does not
+// depend on the number of services.
+func drawMetricCounts(cfg config, services int, seed int64) []int {
+	if cfg.MaxMetrics == 0 {
+		return nil
+	}
+	countRng := rand.New(rand.NewSource(seed - 2))
+	metricCounts := make([]int, services)
+	for i := range metricCounts {
+		metricCounts[i] = cfg.MinMetrics + countRng.Intn(cfg.MaxMetrics-cfg.MinMetrics+1)
+	}
+	return metricCounts
+}
+
+// drawCardScales returns the -cardinality-jitter scale of each of the
+// services, nil without jitter. Like the metric counts, the scale of a
+// service does not depend on the number of services.
+func drawCardScales(jitter float64, services int, seed int64) []float64 {
+	if jitter == 0 {
+		return nil
+	}
+	jitterRng := rand.New(rand.NewSource(seed - 3))
+	cardScales := make([]float64, services)
+	for i := range cardScales {
+		cardScales[i] = 1 + (2*jitterRng.Float64()-1)*jitter/100
+	}
+	return cardScales
+}
+
+// cardinality returns the number of combinations of the attribute values.
+func cardinality(attrConfigs []attributeConfig) int {
+	n := 1
+	for _, attrConfig := range attrConfigs {
+		if !attrConfig.pareto() {
+			n *= attrConfig.Cardinality
+		}
+	}
+	return n
+}
+
+// serviceAttributes returns the attribute combinations of a service with
+// its -cardinality-jitter scale. The combinations are those of the
+// attributes without a paretoAlpha, and the values of the others are drawn
+// for every combination from a generator seeded by seed and the service,
+// so they stay the same for the whole run.
+func serviceAttributes(attrConfigs []attributeConfig, scale float64, mode string, svc service, seed int64) [][]attribute.KeyValue {
+	if !slices.ContainsFunc(attrConfigs, attributeConfig.pareto) {
+		return jitteredAttributes(attrConfigs, scale, mode, svc)
+	}
+	configs := slices.Clone(attrConfigs)
+	rng := rand.New(rand.NewSource(seed - 4 - int64(svc.index)))
+	draws := make([]*rand.Zipf, len(configs))
+	for i, a := range attrConfigs {
+		if a.pareto() {
+			configs[i].Cardinality = 1
+			draws[i] = rand.NewZipf(rng, 1+a.ParetoAlpha, 1, uint64(a.Cardinality-1))
+		}
+	}
+	combinations := jitteredAttributes(configs, scale, mode, svc)
+	for _, attrs := range combinations {
+		for i, a := range attrConfigs {
+			if draws[i] != nil {
+				attrs[i] = attribute.String(a.key(), a.value(int(draws[i].Uint64()), mode, svc))
+			}
+		}
+	}
+	return combinations
+}
+
+// iterateAttributes yields every combination of the configured attribute
+// values for a service. The service only matters for templates and the
+// offset and unique value modes.
+func iterateAttributes(attrConfigs []attributeConfig, mode string, svc service) iter.Seq[[]attribute.KeyValue] {
 	return func(yield func([]attribute.KeyValue) bool) {
 		if len(attrConfigs) == 0 {
 			return
 		}
 		for i := range attrConfigs[0].Cardinality {
-			attr := attribute.String(attrConfigs[0].Name, fmt.Sprintf("%09d", i))
+			attr := attribute.String(attrConfigs[0].key(), attrConfigs[0].value(i, mode, svc))
 			attrs := []attribute.KeyValue{attr}
 			if len(attrConfigs) > 1 {
-				for recAttrs := range iterateAttributes(attrConfigs[1:]) {
+				for recAttrs := range iterateAttributes(attrConfigs[1:], mode, svc) {
 					yield(append(slices.Clone(attrs), recAttrs...))
 				}
 			} else {
@@ -241,3 +2359,72 @@ func iterateAttributes(attrConfigs []attributeConfig) iter.Seq[[]attribute.KeyVa
 		}
 	}
 }
+
+// omitAttributes returns attributes without the optional ones left out of
+// a data point, each with its probability, attributes itself if none are.
+func omitAttributes(attributes []attribute.KeyValue, optional map[attribute.Key]float64, rng *rand.Rand) []attribute.KeyValue {
+	if len(optional) == 0 {
+		return attributes
+	}
+	var kept []attribute.KeyValue
+	omitted := false
+	for _, kv := range attributes {
+		if p, ok := optional[kv.Key]; ok && rng.Float64() < p {
+			omitted = true
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	if !omitted {
+		return attributes
+	}
+	return kept
+}
+
+// emptyAttributes returns attributes with the values of the ones that are
+// empty on a data point replaced by the empty string, each with its
+// probability, attributes itself if none are.
+func emptyAttributes(attributes []attribute.KeyValue, empty map[attribute.Key]float64, rng *rand.Rand) []attribute.KeyValue {
+	if len(empty) == 0 {
+		return attributes
+	}
+	var out []attribute.KeyValue
+	for i, kv := range attributes {
+		if p, ok := empty[kv.Key]; ok && rng.Float64() < p {
+			if out == nil {
+				out = slices.Clone(attributes)
+			}
+			out[i] = kv.Key.String("")
+		}
+	}
+	if out == nil {
+		return attributes
+	}
+	return out
+}
+
+// nthAttributes returns the n-th combination yielded by iterateAttributes
+// without enumerating the ones before it.
+func nthAttributes(attrConfigs []attributeConfig, n int, mode string, svc service) []attribute.KeyValue {
+	return indexedAttributes(attrConfigs, attributeIndexes(attrConfigs, n), mode, svc)
+}
+
+// attributeIndexes returns the value index of each attribute in the n-th
+// combination yielded by iterateAttributes.
+func attributeIndexes(attrConfigs []attributeConfig, n int) []int {
+	indexes := make([]int, len(attrConfigs))
+	for i := len(attrConfigs) - 1; i >= 0; i-- {
+		indexes[i] = n % attrConfigs[i].Cardinality
+		n /= attrConfigs[i].Cardinality
+	}
+	return indexes
+}
+
+// indexedAttributes returns the attributes with the given value indexes.
+func indexedAttributes(attrConfigs []attributeConfig, indexes []int, mode string, svc service) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, len(attrConfigs))
+	for i, c := range attrConfigs {
+		attrs[i] = attribute.String(c.key(), c.value(indexes[i], mode, svc))
+	}
+	return attrs
+}
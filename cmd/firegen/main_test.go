@@ -1,18 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"math/rand"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func TestIterateAttributes(t *testing.T) {
 	attrConfigs := []attributeConfig{
-		{"one", 1},
-		{"two", 2},
-		{"three", 3},
+		{Name: "one", Cardinality: 1},
+		{Name: "two", Cardinality: 2},
+		{Name: "three", Cardinality: 3},
 	}
 
 	expected := [][]attribute.KeyValue{
@@ -48,6 +67,794 @@ func TestIterateAttributes(t *testing.T) {
 		},
 	}
 
-	got := slices.Collect(iterateAttributes(attrConfigs))
+	got := slices.Collect(iterateAttributes(attrConfigs, valuesShared, service{0, "service-0000"}))
 	assert.Equal(t, expected, got)
 }
+
+func TestIterateAttributesTemplate(t *testing.T) {
+	attrConfigs := []attributeConfig{
+		{Name: "region", Cardinality: 2},
+		{Name: "pod", Cardinality: 2, Template: "pod-{{service}}-{{index}}"},
+	}
+
+	expected := [][]attribute.KeyValue{
+		{attribute.String("region", "000000000"), attribute.String("pod", "pod-service-0003-0")},
+		{attribute.String("region", "000000000"), attribute.String("pod", "pod-service-0003-1")},
+		{attribute.String("region", "000000001"), attribute.String("pod", "pod-service-0003-0")},
+		{attribute.String("region", "000000001"), attribute.String("pod", "pod-service-0003-1")},
+	}
+
+	got := slices.Collect(iterateAttributes(attrConfigs, valuesShared, service{3, "service-0003"}))
+	assert.Equal(t, expected, got)
+
+	assert.NoError(t, attrConfigs[1].validate())
+	assert.Error(t, attributeConfig{Name: "pod", Template: "{{host}}"}.validate())
+}
+
+func TestIterateAttributesUnique(t *testing.T) {
+	attrConfigs := []attributeConfig{
+		{Name: "region", Cardinality: 2},
+		{Name: "pod", Cardinality: 1, Template: "pod-{{index}}"},
+	}
+
+	expected := [][]attribute.KeyValue{
+		{attribute.String("region", "service-0001-000000000"), attribute.String("pod", "pod-0")},
+		{attribute.String("region", "service-0001-000000001"), attribute.String("pod", "pod-0")},
+	}
+
+	got := slices.Collect(iterateAttributes(attrConfigs, valuesUnique, service{1, "service-0001"}))
+	assert.Equal(t, expected, got)
+}
+
+func TestIterateAttributesKeyLength(t *testing.T) {
+	attrConfigs := []attributeConfig{
+		{Name: "region", Cardinality: 1, KeyLength: 10},
+		{Name: "pod", Cardinality: 1, KeyLength: 2},
+	}
+
+	expected := [][]attribute.KeyValue{
+		{attribute.String("regionxxxx", "000000000"), attribute.String("pod", "000000000")},
+	}
+
+	got := slices.Collect(iterateAttributes(attrConfigs, valuesShared, service{0, "service-0000"}))
+	assert.Equal(t, expected, got)
+	assert.Error(t, attributeConfig{Name: "pod", KeyLength: -1}.validate())
+}
+
+func TestGaugeSkippedSeriesNotReexported(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(temporality))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	record, err := newInstrument(provider.Meter("test"), metricConfig{Name: "gauge"})
+	require.NoError(t, err)
+
+	record(ctx, 1, metric.WithAttributes(attribute.String("pod", "a")))
+	record(ctx, 1, metric.WithAttributes(attribute.String("pod", "b")))
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	assert.Len(t, rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]).DataPoints, 2)
+
+	record(ctx, 2, metric.WithAttributes(attribute.String("pod", "a")))
+	require.NoError(t, reader.Collect(ctx, &rm))
+	dps := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]).DataPoints
+	require.Len(t, dps, 1)
+	assert.Equal(t, 2.0, dps[0].Value)
+}
+
+func TestOmitAttributes(t *testing.T) {
+	attrs := []attribute.KeyValue{attribute.String("region", "a"), attribute.String("pod", "b"), attribute.String("zone", "c")}
+	rng := rand.New(rand.NewSource(1))
+	assert.Equal(t, attrs, omitAttributes(attrs, nil, rng))
+	assert.Equal(t, attrs[1:], omitAttributes(attrs, map[attribute.Key]float64{"region": 1}, rng))
+	assert.Equal(t, attrs, omitAttributes(attrs, map[attribute.Key]float64{"region": 0}, rng))
+
+	keys := make(map[int]int)
+	for range 1000 {
+		keys[len(omitAttributes(attrs, map[attribute.Key]float64{"pod": 0.5, "zone": 0.5}, rng))]++
+	}
+	assert.InDelta(t, 250, keys[1], 50)
+	assert.InDelta(t, 500, keys[2], 50)
+	assert.InDelta(t, 250, keys[3], 50)
+	assert.Equal(t, attrs, []attribute.KeyValue{attribute.String("region", "a"), attribute.String("pod", "b"), attribute.String("zone", "c")})
+}
+
+func TestEmptyAttributes(t *testing.T) {
+	attrs := []attribute.KeyValue{attribute.String("region", "a"), attribute.String("pod", "b")}
+	rng := rand.New(rand.NewSource(1))
+	assert.Equal(t, attrs, emptyAttributes(attrs, nil, rng))
+	assert.Equal(t, []attribute.KeyValue{attribute.String("region", ""), attribute.String("pod", "b")},
+		emptyAttributes(attrs, map[attribute.Key]float64{"region": 1}, rng))
+	assert.Equal(t, attrs, emptyAttributes(attrs, map[attribute.Key]float64{"region": 0}, rng))
+
+	empty := 0
+	for range 1000 {
+		if emptyAttributes(attrs, map[attribute.Key]float64{"pod": 0.3}, rng)[1].Value.AsString() == "" {
+			empty++
+		}
+	}
+	assert.InDelta(t, 300, empty, 50)
+	assert.Equal(t, attrs, []attribute.KeyValue{attribute.String("region", "a"), attribute.String("pod", "b")})
+}
+
+func TestServiceAttributesPareto(t *testing.T) {
+	attrConfigs := []attributeConfig{
+		{Name: "region", Cardinality: 1000},
+		{Name: "user", Cardinality: 100, ParetoAlpha: 1},
+	}
+	svc := service{0, "service-0000"}
+	attributes := serviceAttributes(attrConfigs, 0, valuesShared, svc, 1)
+	assert.Len(t, attributes, 1000)
+	assert.Equal(t, attributes, serviceAttributes(attrConfigs, 0, valuesShared, svc, 1))
+	assert.NotEqual(t, attributes, serviceAttributes(attrConfigs, 0, valuesShared, svc, 2))
+
+	counts := map[string]int{}
+	for i, attrs := range attributes {
+		assert.Equal(t, attribute.String("region", fmt.Sprintf("%09d", i)), attrs[0])
+		counts[attrs[1].Value.AsString()]++
+	}
+	assert.LessOrEqual(t, len(counts), 100)
+	assert.Greater(t, counts["000000000"], counts["000000001"])
+	assert.Greater(t, counts["000000000"], 300)
+
+	assert.Len(t, serviceAttributes(attrConfigs, 1.5, valuesShared, svc, 1), 1500)
+}
+
+func TestIterateAttributesOffset(t *testing.T) {
+	attrConfigs := []attributeConfig{
+		{Name: "region", Cardinality: 2},
+		{Name: "pod", Cardinality: 3},
+	}
+
+	service0 := slices.Collect(iterateAttributes(attrConfigs, valuesOffset, service{0, "service-0000"}))
+	service1 := slices.Collect(iterateAttributes(attrConfigs, valuesOffset, service{1, "service-0001"}))
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("region", "000000000"), attribute.String("pod", "000000000"),
+	}, service0[0])
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("region", "000000002"), attribute.String("pod", "000000003"),
+	}, service1[0])
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("region", "000000003"), attribute.String("pod", "000000005"),
+	}, service1[len(service1)-1])
+}
+
+func TestNthAttributes(t *testing.T) {
+	attrConfigs := []attributeConfig{
+		{Name: "one", Cardinality: 1},
+		{Name: "two", Cardinality: 2},
+		{Name: "three", Cardinality: 3},
+	}
+
+	svc := service{0, "service-0000"}
+	for n, expected := range slices.Collect(iterateAttributes(attrConfigs, valuesShared, svc)) {
+		assert.Equal(t, expected, nthAttributes(attrConfigs, n, valuesShared, svc))
+	}
+}
+
+func TestScopeMetrics(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	assert.Equal(t, [][]string{{"a", "b", "c"}}, scopeMetrics(names, 1, false))
+	assert.Equal(t, [][]string{{"a", "c"}, {"b"}}, scopeMetrics(names, 2, false))
+	assert.Equal(t, [][]string{names, names}, scopeMetrics(names, 2, true))
+}
+
+func TestDeltaHistogramMinMax(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(deltaHistogramTemporality))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	record, err := newInstrument(provider.Meter("test"), metricConfig{Name: "histogram", metricOptions: metricOptions{Type: metricHistogram}})
+	require.NoError(t, err)
+
+	record(ctx, 3, metric.WithAttributes())
+	record(ctx, 7, metric.WithAttributes())
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	data := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	assert.Equal(t, metricdata.DeltaTemporality, data.Temporality)
+	assert.Equal(t, metricdata.NewExtrema(3.0), data.DataPoints[0].Min)
+	assert.Equal(t, metricdata.NewExtrema(7.0), data.DataPoints[0].Max)
+
+	record(ctx, 5, metric.WithAttributes())
+	require.NoError(t, reader.Collect(ctx, &rm))
+	data = rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64])
+	assert.Equal(t, metricdata.NewExtrema(5.0), data.DataPoints[0].Min)
+	assert.Equal(t, metricdata.NewExtrema(5.0), data.DataPoints[0].Max)
+}
+
+func TestDeltaGauge(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(withDeltaGauges(temporality)))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	record, err := newDeltaGauge(provider.Meter("test"), metricConfig{Name: "gauge"})
+	require.NoError(t, err)
+
+	record(ctx, 5, metric.WithAttributes())
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	data := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[float64])
+	assert.Equal(t, metricdata.DeltaTemporality, data.Temporality)
+	assert.False(t, data.IsMonotonic)
+	require.Len(t, data.DataPoints, 1)
+	assert.Equal(t, 5.0, data.DataPoints[0].Value)
+
+	record(ctx, -2, metric.WithAttributes())
+	require.NoError(t, reader.Collect(ctx, &rm))
+	data = rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Sum[float64])
+	assert.Equal(t, -2.0, data.DataPoints[0].Value)
+	assert.False(t, data.DataPoints[0].StartTime.IsZero())
+}
+
+func TestFractionService(t *testing.T) {
+	for _, fraction := range []float64{0, 0.1, 0.25, 0.5, 0.7, 1} {
+		delta := 0
+		for i := range 100 {
+			if fractionService(i, fraction) {
+				delta++
+			}
+			assert.Equal(t, int(float64(i+1)*fraction), delta, "fraction %g, %d services", fraction, i+1)
+		}
+	}
+	assert.Equal(t, metricdata.DeltaTemporality, deltaTemporality(sdkmetric.InstrumentKindCounter))
+	assert.Equal(t, metricdata.DeltaTemporality, deltaTemporality(sdkmetric.InstrumentKindHistogram))
+	assert.Equal(t, metricdata.DeltaTemporality, deltaTemporality(sdkmetric.InstrumentKindGauge))
+	assert.Equal(t, metricdata.CumulativeTemporality, deltaTemporality(sdkmetric.InstrumentKindUpDownCounter))
+}
+
+func TestChurns(t *testing.T) {
+	for _, rate := range []float64{0.3, 1, 2.5, 12} {
+		const services, ticks = 4, 100
+		total := 0
+		for n := range ticks {
+			perTick := 0
+			for i := range services {
+				perTick += churns(n, rate/services, float64(i)/services)
+			}
+			if n == 0 {
+				assert.Zero(t, perTick)
+			} else {
+				// The phases spread the changes evenly over the ticks.
+				assert.InDelta(t, rate, perTick, 1, "rate %g, tick %d", rate, n)
+			}
+			total += perTick
+		}
+		assert.InDelta(t, rate*(ticks-1), total, services, "rate %g", rate)
+	}
+	assert.Zero(t, churns(5, 0, 0.5))
+}
+
+func TestGenerateError(t *testing.T) {
+	// The expr fails for every service but the first.
+	scopes := [][]metricConfig{{{Name: "m", metricOptions: metricOptions{Expr: "[1.0][service]"}}}}
+	attributes := [][]attribute.KeyValue{{attribute.String("a", "0")}}
+	run := func(index int, opts options) error {
+		svc := service{index, fmt.Sprintf("service-%04d", index)}
+		return generate(context.Background(), serviceConfig{
+			svc:        svc,
+			scopes:     scopes,
+			attributes: attributes,
+			interval:   time.Second,
+			rng:        rand.New(rand.NewSource(1)),
+			st:         &stats{},
+			opts:       opts,
+		})
+	}
+	assert.NoError(t, run(0, options{estimate: true, presence: 1}))
+	assert.ErrorContains(t, run(1, options{estimate: true, presence: 1}), "failed to evaluate expr of metric m")
+	// A failed service stops on its own instead of exiting firegen.
+	assert.ErrorContains(t, run(1, options{benchmark: true, presence: 1}), "index out of range")
+}
+
+func TestScheduleWindow(t *testing.T) {
+	for _, test := range []struct {
+		elapsed time.Duration
+		n       int
+		inside  bool
+	}{
+		{0, 0, false},
+		{30 * time.Second, 0, false},
+		{time.Minute, 1, true},
+		{time.Minute + 9*time.Second, 1, true},
+		{time.Minute + 10*time.Second, 1, false},
+		{2*time.Minute + 5*time.Second, 2, true},
+	} {
+		n, inside := scheduleWindow(test.elapsed, time.Minute, 10*time.Second)
+		assert.Equal(t, test.n, n, "elapsed %s", test.elapsed)
+		assert.Equal(t, test.inside, inside, "elapsed %s", test.elapsed)
+	}
+	_, inside := scheduleWindow(time.Hour, 0, 0)
+	assert.False(t, inside)
+}
+
+// BenchmarkRecordConcurrency records 1000 gauges with 10 series each per
+// iteration, spread over the instruments like -record-concurrency.
+func BenchmarkRecordConcurrency(b *testing.B) {
+	ctx := context.Background()
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(temporality))
+			provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			meter := provider.Meter("bench")
+			records := make([]recordFunc, 1000)
+			for i := range records {
+				record, err := newInstrument(meter, metricConfig{Name: fmt.Sprintf("metric-%04d", i)})
+				require.NoError(b, err)
+				records[i] = record
+			}
+			opts := make([]metric.MeasurementOption, 10)
+			for k := range opts {
+				opts[k] = metric.WithAttributes(attribute.Int("series", k))
+			}
+			for b.Loop() {
+				var wg sync.WaitGroup
+				for w := range workers {
+					wg.Go(func() {
+						for i := w; i < len(records); i += workers {
+							for _, opt := range opts {
+								records[i](ctx, 1, opt)
+							}
+						}
+					})
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
+
+// exportRecorder is the -out-file of a generate test. It keeps the exports
+// and cancels the run after n.
+type exportRecorder struct {
+	mu      sync.Mutex
+	n       int
+	cancel  context.CancelFunc
+	exports []*metricspb.MetricsData
+}
+
+func (r *exportRecorder) Write(b []byte) (int, error) {
+	var md metricspb.MetricsData
+	if err := protojson.Unmarshal(b, &md); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.exports = append(r.exports, &md); len(r.exports) == r.n {
+		r.cancel()
+	}
+	return len(b), nil
+}
+
+// runGenerate runs generate for a service without an endpoint until it
+// made n exports and returns them, with those made while it shuts down.
+func runGenerate(t *testing.T, sc serviceConfig, n int) []*metricspb.MetricsData {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := &exportRecorder{n: n, cancel: cancel}
+	sc.output = &jsonlWriter{w: r}
+	if sc.svc.name == "" {
+		sc.svc = service{0, "service-0000"}
+	}
+	sc.interval = cmp.Or(sc.interval, time.Second)
+	sc.rng = cmp.Or(sc.rng, rand.New(rand.NewSource(1)))
+	sc.st = cmp.Or(sc.st, &stats{})
+	sc.opts.presence = 1
+	if sc.opts.start.IsZero() {
+		sc.opts.start = time.Now()
+	}
+	require.NoError(t, generate(ctx, sc))
+	require.GreaterOrEqual(t, len(r.exports), n)
+	return r.exports
+}
+
+// dataPoints returns the values of the gauge and sum data points of the
+// metric name in md, keyed by their attributes.
+func dataPoints(md *metricspb.MetricsData, name string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, rm := range md.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.Name != name {
+					continue
+				}
+				points := m.GetGauge().GetDataPoints()
+				if m.GetSum() != nil {
+					points = m.GetSum().DataPoints
+				}
+				for _, dp := range points {
+					values[keyValues(dp.Attributes)] = dp.GetAsDouble()
+				}
+			}
+		}
+	}
+	return values
+}
+
+// keyValues formats attributes as k=v pairs.
+func keyValues(attrs []*commonpb.KeyValue) string {
+	var pairs []string
+	for _, kv := range attrs {
+		value := kv.Value.GetStringValue()
+		if v, ok := kv.Value.Value.(*commonpb.AnyValue_IntValue); ok {
+			value = fmt.Sprint(v.IntValue)
+		}
+		pairs = append(pairs, kv.Key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func TestGenerateResourceChange(t *testing.T) {
+	sc := serviceConfig{
+		scopes:             [][]metricConfig{{{Name: "requests", metricOptions: metricOptions{Type: metricCounter, Expr: "1"}}}},
+		attributes:         [][]attribute.KeyValue{{attribute.String("a", "0")}},
+		resourceAttributes: []attributeConfig{{Name: "version", Cardinality: 100, ChangeEvery: 2}},
+		opts:               options{benchmark: true},
+	}
+	exports := runGenerate(t, sc, 6)
+	var versions []string
+	for i, md := range exports {
+		versions = append(versions, keyValues(md.ResourceMetrics[0].Resource.Attributes))
+		// The counter keeps counting across the new resources.
+		assert.Equal(t, map[string]float64{"a=0": float64(i + 1)}, dataPoints(md, "requests"), "export %d", i)
+	}
+	assert.Equal(t, []string{
+		"service.name=service-0000,version=000000000",
+		"service.name=service-0000,version=000000000",
+		"service.name=service-0000,version=000000001",
+		"service.name=service-0000,version=000000001",
+		"service.name=service-0000,version=000000002",
+		"service.name=service-0000,version=000000002",
+	}, versions)
+}
+
+func TestGenerateResourceChangePeriodic(t *testing.T) {
+	st := &stats{}
+	sc := serviceConfig{
+		scopes:             [][]metricConfig{{{Name: "requests", metricOptions: metricOptions{Type: metricCounter, Expr: "1"}}}},
+		attributes:         [][]attribute.KeyValue{{attribute.String("a", "0")}},
+		resourceAttributes: []attributeConfig{{Name: "version", Cardinality: 1000, ChangeEvery: 2}},
+		interval:           10 * time.Millisecond,
+		st:                 st,
+		opts:               options{reader: readerOptions{mode: readerPeriodic, every: 5 * time.Millisecond}, timeout: time.Second},
+	}
+	exports := runGenerate(t, sc, 20)
+	require.Positive(t, st.resourceChanges.Load())
+	last, total := "", 0.0
+	seen := make(map[string]bool)
+	for i, md := range exports {
+		version := keyValues(md.ResourceMetrics[0].Resource.Attributes)
+		if version != last {
+			// Once a new resource exports, the reader of the old one is
+			// shut down and never exports again.
+			assert.False(t, seen[version], "export %d: %s exported after it was replaced", i, version)
+			seen[version], last = true, version
+		}
+		value := dataPoints(md, "requests")["a=0"]
+		assert.GreaterOrEqual(t, value, total, "export %d", i)
+		total = value
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestGenerateCardinalityGrowth(t *testing.T) {
+	st := &stats{}
+	st.series.Store(2)
+	sc := serviceConfig{
+		scopes:     [][]metricConfig{{{Name: "a"}, {Name: "b"}}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		st:         st,
+		opts:       options{benchmark: true, cardinality: cardinalityOptions{growth: 3, maxSeries: 10}},
+	}
+	exports := runGenerate(t, sc, 5)
+	var series []int
+	for _, md := range exports {
+		series = append(series, len(dataPoints(md, "a"))+len(dataPoints(md, "b")))
+	}
+	// Three series per tick until the tenth.
+	assert.Equal(t, []int{5, 8, 10, 10, 10}, series)
+	assert.Equal(t, int64(10), st.series.Load())
+	// The new series take turns between the metrics.
+	assert.ElementsMatch(t, []string{"host=0", "firegen.series=000000000", "firegen.series=000000001"}, slices.Collect(maps.Keys(dataPoints(exports[0], "a"))))
+	assert.ElementsMatch(t, []string{"host=0", "firegen.series=000000000"}, slices.Collect(maps.Keys(dataPoints(exports[0], "b"))))
+}
+
+func TestGenerateCardinalityGrowthRandomWalk(t *testing.T) {
+	lo, hi, step := 0.0, 1000.0, 1.0
+	st := &stats{}
+	st.series.Store(1)
+	sc := serviceConfig{
+		scopes:     [][]metricConfig{{{Name: "w", metricOptions: metricOptions{Pattern: patternRandomWalk, Min: &lo, Max: &hi, Step: &step}}}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		st:         st,
+		opts:       options{benchmark: true, cardinality: cardinalityOptions{growth: 2, maxSeries: 3}},
+	}
+	exports := runGenerate(t, sc, 6)
+	for k := 2; k < len(exports); k++ {
+		prev, cur := dataPoints(exports[k-1], "w"), dataPoints(exports[k], "w")
+		require.Len(t, cur, 3)
+		// The grown series walk instead of jumping across [min, max].
+		for key, v := range cur {
+			assert.InDelta(t, prev[key], v, step, "tick %d %s", k+1, key)
+		}
+	}
+}
+
+func TestGenerateNewSeries(t *testing.T) {
+	st := &stats{}
+	sc := serviceConfig{
+		scopes:     [][]metricConfig{{{Name: "g"}}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		st:         st,
+		opts:       options{benchmark: true, newSeries: newSeriesOptions{perInterval: 2, lifetime: 3}},
+	}
+	exports := runGenerate(t, sc, 5)
+	for k, md := range exports {
+		// After k+1 ticks the ring holds the series of the last three.
+		want := []string{"host=0"}
+		for id := max(0, 2*(k+1)-6); id < 2*(k+1); id++ {
+			want = append(want, fmt.Sprintf("firegen.churn=%012d", id))
+		}
+		assert.ElementsMatch(t, want, slices.Collect(maps.Keys(dataPoints(md, "g"))), "tick %d", k+1)
+	}
+	assert.Equal(t, int64(10), st.newSeries.Load())
+}
+
+func TestGenerateBurst(t *testing.T) {
+	for _, test := range []struct {
+		elapsed time.Duration
+		n       int
+	}{
+		{30 * time.Minute, 0},
+		{time.Hour + 5*time.Minute, 1},
+		{time.Hour + 15*time.Minute, 0},
+		{2*time.Hour + time.Minute, 2},
+	} {
+		sc := serviceConfig{
+			scopes:     [][]metricConfig{{{Name: "a"}, {Name: "b"}}},
+			attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+			opts: options{
+				benchmark: true,
+				start:     time.Now().Add(-test.elapsed),
+				burst:     burstOptions{series: 5, every: time.Hour, duration: 10 * time.Minute},
+			},
+		}
+		md := runGenerate(t, sc, 2)[1]
+		a, b := []string{"host=0"}, []string{"host=0"}
+		if test.n > 0 {
+			// The burst series take turns between the gauges.
+			for s := range 5 {
+				attrs := fmt.Sprintf("firegen.burst=%d-%09d", test.n, s)
+				if s%2 == 0 {
+					a = append(a, attrs)
+				} else {
+					b = append(b, attrs)
+				}
+			}
+		}
+		assert.ElementsMatch(t, a, slices.Collect(maps.Keys(dataPoints(md, "a"))), "elapsed %s", test.elapsed)
+		assert.ElementsMatch(t, b, slices.Collect(maps.Keys(dataPoints(md, "b"))), "elapsed %s", test.elapsed)
+	}
+}
+
+func TestGenerateTerminate(t *testing.T) {
+	sentinel := -1.0
+	sc := serviceConfig{
+		scopes: [][]metricConfig{{
+			{Name: "g", metricOptions: metricOptions{Expr: "5"}},
+			{Name: "c", metricOptions: metricOptions{Type: metricCounter, Expr: "1"}},
+		}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}, {attribute.String("host", "1")}},
+		interval:   10 * time.Millisecond,
+		opts:       options{terminate: &sentinel, timeout: time.Second},
+	}
+	exports := runGenerate(t, sc, 2)
+	require.Len(t, exports, 3)
+	for _, md := range exports[:2] {
+		assert.Equal(t, map[string]float64{"host=0": 5, "host=1": 5}, dataPoints(md, "g"))
+	}
+	// The final export after the shutdown records the sentinel for every
+	// gauge series and leaves the counters.
+	assert.Equal(t, map[string]float64{"host=0": -1, "host=1": -1}, dataPoints(exports[2], "g"))
+	assert.Equal(t, map[string]float64{"host=0": 2, "host=1": 2}, dataPoints(exports[2], "c"))
+}
+
+func TestCollapsedScopes(t *testing.T) {
+	metrics := []metricConfig{{Name: "m0"}, {Name: "m1"}, {Name: "m2"}, {Name: "m3"}}
+	services := func(c int) ([][]metricConfig, [][]metricConfig) {
+		return splitScopes(metrics[:c+2], 2, false)
+	}
+	assert.Equal(t, [][]metricConfig{{{Name: "m0"}}, {{Name: "m1"}}}, collapsedScopes(0, 1, true, services))
+
+	// Three services collapse into the scopes of one, the second with the
+	// conflicting types.
+	scopes := collapsedScopes(0, 3, true, services)
+	_, conflicting := services(1)
+	want := [][]metricConfig{{{Name: "m0"}}, {{Name: "m1"}}}
+	want = append(want, conflicting...)
+	want = append(want, [][]metricConfig{{{Name: "m0"}, {Name: "m2"}}, {{Name: "m1"}, {Name: "m3"}}}...)
+	assert.Equal(t, want, scopes)
+
+	md := runGenerate(t, serviceConfig{
+		scopes:     scopes,
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		opts:       options{benchmark: true},
+	}, 1)[0]
+	require.Len(t, md.ResourceMetrics, 1)
+	var names []string
+	for _, sm := range md.ResourceMetrics[0].ScopeMetrics {
+		names = append(names, sm.Scope.Name)
+	}
+	assert.ElementsMatch(t, []string{
+		"firegen-service-0000-scope-00",
+		"firegen-service-0000-scope-01",
+		"firegen-service-0000-scope-02",
+		"firegen-service-0000-scope-03",
+		"firegen-service-0000-scope-04",
+		"firegen-service-0000-scope-05",
+	}, names)
+}
+
+func TestGenerateSequenceNumbers(t *testing.T) {
+	st := &stats{}
+	sc := serviceConfig{
+		scopes:             [][]metricConfig{{{Name: "g"}}},
+		attributes:         [][]attribute.KeyValue{{attribute.String("host", "0")}, {attribute.String("host", "1")}},
+		resourceAttributes: []attributeConfig{{Name: "version", Cardinality: 10, ChangeEvery: 2}},
+		st:                 st,
+		opts:               options{benchmark: true, sequence: true},
+	}
+	exports := runGenerate(t, sc, 5)
+	for k, md := range exports {
+		// Every export advances each series by one, across the rebuilt
+		// providers of the resource changes.
+		points := slices.Collect(maps.Keys(dataPoints(md, "g")))
+		assert.ElementsMatch(t, []string{
+			fmt.Sprintf("firegen.seq=%d,host=0", k),
+			fmt.Sprintf("firegen.seq=%d,host=1", k),
+		}, points, "export %d", k)
+	}
+	assert.Equal(t, int64(2), st.resourceChanges.Load())
+}
+
+func TestGenerateStale(t *testing.T) {
+	var attributes [][]attribute.KeyValue
+	for host := range 10 {
+		attributes = append(attributes, []attribute.KeyValue{attribute.Int("host", host)})
+	}
+	sc := serviceConfig{
+		scopes:     [][]metricConfig{{{Name: "g"}}},
+		attributes: attributes,
+		opts:       options{benchmark: true, stale: staleOptions{fraction: 0.3, intervals: 2}},
+	}
+	exports := runGenerate(t, sc, 30)
+	stale := 0
+	for host := range 10 {
+		key := fmt.Sprintf("host=%d", host)
+		for k := 0; k < len(exports); k++ {
+			value, ok := dataPoints(exports[k], "g")[key]
+			require.True(t, ok, "export %d: %s missing", k, key)
+			if !math.IsNaN(value) {
+				continue
+			}
+			// A removed series gets a stale point, then stays silent for
+			// -stale-intervals before it resumes.
+			stale++
+			for end := min(len(exports), k+3); k+1 < end; {
+				k++
+				assert.NotContains(t, dataPoints(exports[k], "g"), key, "export %d", k)
+			}
+		}
+	}
+	assert.Positive(t, stale)
+}
+
+func TestDrawMetricCounts(t *testing.T) {
+	assert.Nil(t, drawMetricCounts(config{}, 10, 1))
+
+	cfg := config{MinMetrics: 2, MaxMetrics: 5}
+	counts := drawMetricCounts(cfg, 200, 1)
+	require.Len(t, counts, 200)
+	assert.Equal(t, 2, slices.Min(counts))
+	assert.Equal(t, 5, slices.Max(counts))
+	assert.Equal(t, counts, drawMetricCounts(cfg, 200, 1), "the same seed draws the same counts")
+	assert.Equal(t, []int{3, 3}, drawMetricCounts(config{MinMetrics: 3, MaxMetrics: 3}, 2, 1))
+
+	var buf bytes.Buffer
+	defer func(logger *log.Logger) { infoLog = logger }(infoLog)
+	infoLog = log.New(&buf, "", 0)
+	metrics := []metricConfig{{Name: "m0"}, {Name: "m1"}, {Name: "m2"}, {Name: "m3"}, {Name: "m4"}}
+	total := options{}.logSeries(cfg, []tenantConfig{{Services: 200}}, [][]metricConfig{metrics}, counts, nil, 10)
+	sum := 0
+	for _, n := range counts {
+		sum += n
+	}
+	assert.Equal(t, 10*sum, total)
+	assert.Equal(t, fmt.Sprintf("Series per service 20-50, %d on average\n", 10*sum/200), buf.String())
+}
+
+func TestGenerateHistogramObservations(t *testing.T) {
+	sc := serviceConfig{
+		scopes:     [][]metricConfig{{{Name: "h", metricOptions: metricOptions{Type: metricHistogram}}}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		opts:       options{benchmark: true},
+	}
+	exports := runGenerate(t, sc, 3)
+	for i, md := range exports {
+		dps := md.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetHistogram().GetDataPoints()
+		require.Len(t, dps, 1)
+		// The observations of every tick are spread over the buckets.
+		assert.Equal(t, uint64(defaultObservations*(i+1)), dps[0].Count)
+		buckets := 0
+		for _, n := range dps[0].BucketCounts {
+			if n > 0 {
+				buckets++
+			}
+		}
+		assert.Greater(t, buckets, 1, "export %d: %v", i, dps[0].BucketCounts)
+	}
+}
+
+func TestGenerateDistributionVirtualClock(t *testing.T) {
+	// An hour of event time passes every wall clock second.
+	now := time.Now()
+	clock := virtualClock{wall: now, start: now.Add(-24 * time.Hour), speed: 3600}
+	sc := serviceConfig{
+		scopes: [][]metricConfig{{{Name: "ramp", metricOptions: metricOptions{
+			Distribution: &distributionConfig{Type: distributionRamp, Slope: 1},
+		}}}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		opts:       options{benchmark: true, clock: clock, start: now.Add(-time.Second)},
+	}
+	start := clock.at(sc.opts.start)
+	for i, md := range runGenerate(t, sc, 3) {
+		dp := md.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetGauge().DataPoints[0]
+		// The ramp counts the seconds of event time up to the timestamp.
+		elapsed := time.Unix(0, int64(dp.TimeUnixNano)).Sub(start).Seconds()
+		assert.Greater(t, elapsed, 3000.0)
+		assert.InDelta(t, elapsed, dp.GetAsDouble(), 360, "export %d", i)
+	}
+}
+
+func TestGenerateRateVirtualClock(t *testing.T) {
+	rate := 2.0
+	now := time.Now()
+	sc := serviceConfig{
+		scopes:     [][]metricConfig{{{Name: "c", metricOptions: metricOptions{Type: metricCounter, Rate: &rate}}}},
+		attributes: [][]attribute.KeyValue{{attribute.String("host", "0")}},
+		opts:       options{benchmark: true, clock: virtualClock{wall: now, start: now.Add(-24 * time.Hour), speed: 3600}},
+	}
+	var values, times []float64
+	for _, md := range runGenerate(t, sc, 20) {
+		dp := md.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetSum().DataPoints[0]
+		values, times = append(values, dp.GetAsDouble()), append(times, float64(dp.TimeUnixNano)/1e9)
+	}
+	// The counter grows by the rate per second of event time although the
+	// ticks are back to back and the clock runs fast.
+	n := len(values) - 1
+	assert.InEpsilon(t, rate, (values[n]-values[1])/(times[n]-times[1]), 0.25)
+}
+
+func TestEveryIntervalReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var interval atomic.Int64
+	interval.Store(int64(5 * time.Millisecond))
+	var got []time.Duration
+	var at []time.Time
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		everyInterval(ctx, &interval, func(d time.Duration) {
+			got, at = append(got, d), append(at, time.Now())
+			switch len(got) {
+			case 2:
+				// A reload changes the interval.
+				interval.Store(int64(50 * time.Millisecond))
+			case 4:
+				cancel()
+			}
+		})
+	}()
+	<-done
+	assert.Equal(t, []time.Duration{5 * time.Millisecond, 5 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}, got)
+	assert.GreaterOrEqual(t, at[3].Sub(at[2]), 40*time.Millisecond)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Modes of -malformed-mode.
+const (
+	// malformedResource exports the ResourceMetrics with an empty resource,
+	// without service.name or any other attribute.
+	malformedResource = "resource"
+	// malformedScope exports every ScopeMetrics with an empty scope, without
+	// a name.
+	malformedScope = "scope"
+)
+
+// malformMetrics returns a copy of rm with its resource or the scopes of its
+// ScopeMetrics stripped according to mode, an invalid OTLP payload for
+// negative testing of the receivers. rm is unchanged, the metrics are
+// shared with it.
+func malformMetrics(rm *metricdata.ResourceMetrics, mode string) *metricdata.ResourceMetrics {
+	malformed := *rm
+	switch mode {
+	case malformedResource:
+		malformed.Resource = resource.Empty()
+	case malformedScope:
+		malformed.ScopeMetrics = make([]metricdata.ScopeMetrics, len(rm.ScopeMetrics))
+		for i, sm := range rm.ScopeMetrics {
+			sm.Scope = instrumentation.Scope{}
+			malformed.ScopeMetrics[i] = sm
+		}
+	}
+	return &malformed
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestMalformMetrics(t *testing.T) {
+	res := resource.NewSchemaless(attribute.String("service.name", "service-0000"))
+	rm := &metricdata.ResourceMetrics{Resource: res, ScopeMetrics: []metricdata.ScopeMetrics{
+		{Scope: instrumentation.Scope{Name: "scope-00", Version: "1"}, Metrics: []metricdata.Metrics{{Name: "a"}}},
+		{Scope: instrumentation.Scope{Name: "scope-01"}, Metrics: []metricdata.Metrics{{Name: "b"}}},
+	}}
+
+	malformed := malformMetrics(rm, malformedResource)
+	assert.Zero(t, malformed.Resource.Len())
+	assert.Equal(t, rm.ScopeMetrics, malformed.ScopeMetrics)
+
+	malformed = malformMetrics(rm, malformedScope)
+	assert.Equal(t, res, malformed.Resource)
+	for i, sm := range malformed.ScopeMetrics {
+		assert.Equal(t, instrumentation.Scope{}, sm.Scope)
+		assert.Equal(t, rm.ScopeMetrics[i].Metrics, sm.Metrics)
+	}
+
+	assert.Equal(t, res, rm.Resource)
+	assert.Equal(t, "scope-00", rm.ScopeMetrics[0].Scope.Name)
+	assert.Equal(t, "scope-01", rm.ScopeMetrics[1].Scope.Name)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// nanValue returns NaN instead of value with probability fraction, counting
+// the NaN recordings in st.
+func nanValue(rng *rand.Rand, fraction, value float64, st *stats) float64 {
+	if fraction == 0 || rng.Float64() >= fraction {
+		return value
+	}
+	st.nans.Add(1)
+	return math.NaN()
+}
+
+// nanSums returns the number of histogram data points in rm whose sum is
+// NaN, those a NaN recording was aggregated into rather than dropped.
+func nanSums(rm *metricdata.ResourceMetrics) int {
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if data, ok := m.Data.(metricdata.Histogram[float64]); ok {
+				for _, dp := range data.DataPoints {
+					if math.IsNaN(dp.Sum) {
+						n++
+					}
+				}
+			}
+		}
+	}
+	return n
+}
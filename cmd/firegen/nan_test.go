@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestNaNValue(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var st stats
+	assert.Equal(t, 2.0, nanValue(rng, 0, 2, &st))
+	assert.True(t, math.IsNaN(nanValue(rng, 1, 2, &st)))
+	assert.Equal(t, int64(1), st.nans.Load())
+}
+
+func TestNaNSums(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(temporality))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	record, err := newInstrument(provider.Meter("test"), metricConfig{Name: "latency", metricOptions: metricOptions{Type: metricHistogram}})
+	require.NoError(t, err)
+
+	clean := metric.WithAttributes(attribute.String("pod", "a"))
+	record(ctx, 1, clean)
+	record(ctx, 3, clean)
+	nan := metric.WithAttributes(attribute.String("pod", "b"))
+	record(ctx, 1, nan)
+	record(ctx, math.NaN(), nan)
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	assert.Equal(t, 1, nanSums(&rm))
+
+	// The SDK counts the NaN recording, in the last bucket.
+	for _, dp := range rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64]).DataPoints {
+		assert.Equal(t, uint64(2), dp.Count)
+		if pod, _ := dp.Attributes.Value("pod"); pod.AsString() == "b" {
+			assert.Equal(t, uint64(1), dp.BucketCounts[len(dp.BucketCounts)-1])
+		}
+	}
+}
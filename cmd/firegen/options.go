@@ -0,0 +1,591 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+type options struct {
+	configFiles  stringList
+	configMerge  string
+	endpoint     string
+	plaintext    bool
+	tlsVersion   string
+	tlsCiphers   string
+	tls          *tls.Config
+	token        string
+	useHTTP      bool
+	protocol     string
+	kafka        kafkaOptions
+	urlPath      string
+	username     string
+	password     string
+	headers      map[string]string
+	timeout      time.Duration
+	otlpTimeout  time.Duration
+	userAgent    string
+	seed         int64
+	presence     float64
+	replay       bool
+	replayFile   string
+	restamp      bool
+	outFile      string
+	promAddr     string
+	quiet        bool
+	valueMode    string
+	stale        staleOptions
+	duration     time.Duration
+	benchmark    bool
+	negative     float64
+	skipEmpty    bool
+	maxPoints    int
+	requests     int
+	churn        churnOptions
+	cardinality  cardinalityOptions
+	newSeries    newSeriesOptions
+	burst        burstOptions
+	chaos        chaosOptions
+	corrupt      corruptOptions
+	interceptors interceptorOptions
+	malformed    malformedOptions
+	flap         flapOptions
+	hourlyLoad   []float64
+	conflicting  bool
+	detect       bool
+	delta        deltaOptions
+	sequence     bool
+	skew         time.Duration
+	drift        time.Duration
+	clockStart   string
+	clockSpeed   float64
+	clock        virtualClock
+	check        bool
+	estimate     bool
+	conn         connectionOptions
+	inflight     inflightOptions
+	recorders    int
+	single       bool
+	version      bool
+	lint         bool
+	reload       bool
+	failFast     bool
+	schemaClash  bool
+	golden       bool
+	terminate    *float64
+	start        time.Time
+	scrape       *scrapeTarget
+	points       pointOptions
+	metricOrder  string
+	heartbeat    time.Duration
+	optional     map[attribute.Key]float64
+	empty        map[attribute.Key]float64
+	reader       readerOptions
+	rampStep     int
+}
+
+// kafkaOptions are the settings of -protocol kafka.
+type kafkaOptions struct {
+	brokers string
+	topic   string
+	sasl    string
+}
+
+// staleOptions are the settings of -stale-fraction.
+type staleOptions struct {
+	fraction  float64
+	intervals int
+}
+
+// churnOptions are the settings of -resource-churn-rate. The rate and phase
+// are those of one service, shifting its changes against the others.
+type churnOptions struct {
+	rate  float64
+	phase float64
+	key   string
+}
+
+// cardinalityOptions are the settings that change the series of the
+// services over time or between them. The scale is the -cardinality-jitter
+// scale of one service.
+type cardinalityOptions struct {
+	jitter    float64
+	scale     float64
+	growth    int
+	maxSeries int
+	limit     int
+}
+
+// newSeriesOptions are the settings of -new-series-per-interval.
+type newSeriesOptions struct {
+	perInterval int
+	lifetime    int
+}
+
+// burstOptions are the settings of -burst-series.
+type burstOptions struct {
+	series   int
+	every    time.Duration
+	duration time.Duration
+}
+
+// chaosOptions are the settings of -chaos-probability and -chaos-every.
+type chaosOptions struct {
+	probability float64
+	every       time.Duration
+	duration    time.Duration
+}
+
+// corruptOptions are the settings of -corrupt-probability.
+type corruptOptions struct {
+	probability float64
+	mode        string
+	corrupter   *corrupter
+}
+
+// interceptorOptions are the settings of -grpc-interceptors.
+type interceptorOptions struct {
+	names    string
+	failProb float64
+	chain    *interceptorChain
+}
+
+// malformedOptions are the settings of -malformed-probability.
+type malformedOptions struct {
+	probability float64
+	mode        string
+}
+
+// flapOptions are the settings of -flap-fraction. A service flaps if it is
+// enabled.
+type flapOptions struct {
+	fraction float64
+	period   time.Duration
+	enabled  bool
+}
+
+// deltaOptions are the temporality settings. A service exports its counters
+// and histograms with delta temporality if it is enabled.
+type deltaOptions struct {
+	histograms bool
+	gauges     bool
+	fraction   float64
+	enabled    bool
+}
+
+// pointOptions are the settings that change the data points on the wire.
+type pointOptions struct {
+	flags      string
+	flagged    float64
+	order      string
+	duplicates float64
+	rewrite    *rewriter
+}
+
+// connectionOptions are the settings of how the services connect to the
+// endpoint.
+type connectionOptions struct {
+	perConn     int
+	pool        *connectionPool
+	reconnect   int
+	parallelism int
+	initConc    int
+	init        *exporterInit
+	startup     time.Duration
+	launch      time.Duration
+}
+
+// inflightOptions are the settings of -max-inflight.
+type inflightOptions struct {
+	max      int
+	skipBusy bool
+	limit    *inflightLimit
+}
+
+// readerOptions are the settings of -reader.
+type readerOptions struct {
+	mode  string
+	every time.Duration
+}
+
+// validate checks the flags and derives the settings that depend on them
+// only. The errors start with the invalid flag.
+func (opts *options) validate() error {
+	if opts.cardinality.limit < 0 {
+		return fmt.Errorf("-cardinality-limit %d: must not be negative", opts.cardinality.limit)
+	}
+	if opts.presence < 0 || opts.presence > 1 {
+		return fmt.Errorf("-attribute-presence %g: must be between 0 and 1", opts.presence)
+	}
+	if opts.stale.fraction < 0 || opts.stale.fraction > 1 {
+		return fmt.Errorf("-stale-fraction %g: must be between 0 and 1", opts.stale.fraction)
+	}
+	opts.stale.intervals = max(1, opts.stale.intervals)
+	opts.conn.parallelism = max(1, opts.conn.parallelism)
+	opts.recorders = max(1, opts.recorders)
+	switch opts.valueMode {
+	case valuesShared, valuesOffset, valuesUnique:
+	default:
+		return fmt.Errorf("-attribute-values %q: must be %s, %s or %s", opts.valueMode, valuesShared, valuesOffset, valuesUnique)
+	}
+	tlsConfig, err := newTLSConfig(opts.tlsVersion, opts.tlsCiphers)
+	if err != nil {
+		return fmt.Errorf("-tls-min-version or -tls-cipher-suites: %w", err)
+	} else if tlsConfig != nil && opts.plaintext {
+		return fmt.Errorf("-tls-min-version and -tls-cipher-suites: cannot be combined with -plaintext")
+	}
+	opts.tls = tlsConfig
+	switch opts.protocol {
+	case "":
+		opts.protocol = protocolGRPC
+		if opts.useHTTP {
+			opts.protocol = protocolHTTP
+		}
+	case protocolHTTP:
+		opts.useHTTP = true
+	case protocolGRPC, protocolKafka, protocolStdout:
+		if opts.useHTTP {
+			return fmt.Errorf("-http: cannot be combined with -protocol %s", opts.protocol)
+		}
+	default:
+		return fmt.Errorf("-protocol %q: must be %s, %s, %s or %s", opts.protocol, protocolGRPC, protocolHTTP, protocolKafka, protocolStdout)
+	}
+	if opts.protocol == protocolKafka {
+		if opts.kafka.brokers == "" || opts.kafka.topic == "" {
+			return fmt.Errorf("-protocol %s: requires -kafka-brokers and -kafka-topic", protocolKafka)
+		}
+		opts.endpoint = opts.kafka.brokers
+	} else if opts.kafka.sasl != "" {
+		return fmt.Errorf("-kafka-sasl-mechanism: requires -protocol %s", protocolKafka)
+	}
+	if opts.protocol == protocolStdout {
+		// The endpoint enables the export, and names it in the logs.
+		opts.endpoint = protocolStdout
+	}
+	if opts.urlPath != "" && !strings.HasPrefix(opts.urlPath, "/") {
+		return fmt.Errorf("-http-url-path %q: must start with /", opts.urlPath)
+	}
+	if opts.maxPoints < 0 {
+		return fmt.Errorf("-max-points-per-request %d: must not be negative", opts.maxPoints)
+	}
+	if opts.requests < 0 {
+		return fmt.Errorf("-requests-per-interval %d: must not be negative", opts.requests)
+	} else if opts.requests > 0 && opts.endpoint == "" {
+		return fmt.Errorf("-requests-per-interval: requires an -endpoint")
+	} else if opts.requests > 0 && opts.maxPoints > 0 {
+		return fmt.Errorf("-requests-per-interval: cannot be combined with -max-points-per-request")
+	} else if opts.requests > 0 && (opts.replay || opts.benchmark || opts.estimate) {
+		return fmt.Errorf("-requests-per-interval: cannot be combined with -replay, -benchmark or -estimate-bandwidth")
+	}
+	if opts.conn.parallelism > 1 && opts.maxPoints == 0 && opts.requests == 0 {
+		return fmt.Errorf("-export-parallelism: requires -max-points-per-request or -requests-per-interval")
+	}
+	if opts.conn.initConc < 0 {
+		return fmt.Errorf("-exporter-init-concurrency %d: must not be negative", opts.conn.initConc)
+	}
+	if opts.inflight.max < 0 {
+		return fmt.Errorf("-max-inflight %d: must not be negative", opts.inflight.max)
+	} else if opts.inflight.max > 0 {
+		opts.inflight.limit = newInflightLimit(opts.inflight.max, opts.inflight.skipBusy)
+	} else if opts.inflight.skipBusy {
+		return fmt.Errorf("-max-inflight-skip: requires -max-inflight")
+	}
+	if opts.conn.launch < 0 {
+		return fmt.Errorf("-launch-interval %s: must not be negative", opts.conn.launch)
+	}
+	if opts.heartbeat < 0 {
+		return fmt.Errorf("-heartbeat %s: must not be negative", opts.heartbeat)
+	}
+	if opts.cardinality.jitter < 0 || opts.cardinality.jitter >= 100 {
+		return fmt.Errorf("-cardinality-jitter %g: must be at least 0 and less than 100", opts.cardinality.jitter)
+	} else if opts.cardinality.jitter > 0 && opts.valueMode == valuesOffset {
+		return fmt.Errorf("-cardinality-jitter: cannot be combined with -attribute-values %s, the value ranges of the services would overlap", valuesOffset)
+	}
+	if opts.cardinality.growth < 0 {
+		return fmt.Errorf("-cardinality-growth %d: must not be negative", opts.cardinality.growth)
+	} else if opts.cardinality.growth > 0 && opts.replay {
+		return fmt.Errorf("-cardinality-growth: cannot grow the replayed snapshot")
+	}
+	if opts.newSeries.perInterval < 0 {
+		return fmt.Errorf("-new-series-per-interval %d: must not be negative", opts.newSeries.perInterval)
+	} else if opts.newSeries.lifetime < 1 {
+		return fmt.Errorf("-new-series-lifetime %d: must be at least 1", opts.newSeries.lifetime)
+	} else if opts.newSeries.perInterval > 0 && opts.replay {
+		return fmt.Errorf("-new-series-per-interval: cannot add series to the replayed snapshot")
+	}
+	if opts.burst.series < 0 {
+		return fmt.Errorf("-burst-series %d: must not be negative", opts.burst.series)
+	} else if opts.burst.series > 0 {
+		if opts.burst.every <= 0 || opts.burst.duration <= 0 {
+			return fmt.Errorf("-burst-series: requires -burst-every and -burst-duration")
+		} else if opts.burst.duration >= opts.burst.every {
+			return fmt.Errorf("-burst-duration %s: must be shorter than -burst-every %s", opts.burst.duration, opts.burst.every)
+		} else if opts.replay {
+			return fmt.Errorf("-burst-series: cannot add bursts to the replayed snapshot")
+		}
+	}
+	if opts.chaos.probability < 0 || opts.chaos.probability > 1 {
+		return fmt.Errorf("-chaos-probability %g: must be between 0 and 1", opts.chaos.probability)
+	}
+	if opts.chaos.every < 0 || opts.chaos.duration < 0 {
+		return fmt.Errorf("-chaos-every and -chaos-duration: must not be negative")
+	} else if (opts.chaos.every > 0) != (opts.chaos.duration > 0) {
+		return fmt.Errorf("-chaos-every: requires -chaos-duration and vice versa")
+	} else if opts.chaos.every > 0 && opts.chaos.duration >= opts.chaos.every {
+		return fmt.Errorf("-chaos-duration %s: must be shorter than -chaos-every %s", opts.chaos.duration, opts.chaos.every)
+	}
+	if opts.flap.fraction < 0 || opts.flap.fraction > 1 {
+		return fmt.Errorf("-flap-fraction %g: must be between 0 and 1", opts.flap.fraction)
+	} else if opts.flap.fraction > 0 && opts.flap.period <= 0 {
+		return fmt.Errorf("-flap-period %s: must be positive", opts.flap.period)
+	} else if opts.flap.fraction > 0 && (opts.benchmark || opts.estimate) {
+		return fmt.Errorf("-flap-fraction: cannot be combined with -benchmark or -estimate-bandwidth")
+	}
+	if opts.terminate != nil && (opts.replay || opts.benchmark) {
+		return fmt.Errorf("-terminate-with-value: cannot be combined with -replay or -benchmark")
+	}
+	if opts.drift < 0 {
+		return fmt.Errorf("-clock-drift-max %s: must not be negative", opts.drift)
+	}
+	opts.clock = virtualClock{wall: time.Now(), speed: opts.clockSpeed}
+	opts.clock.start = opts.clock.wall
+	if opts.clockStart != "" {
+		if opts.clock.start, err = time.Parse(time.RFC3339, opts.clockStart); err != nil {
+			return fmt.Errorf("-clock-start %q: must be an RFC 3339 time, e.g. 2025-01-01T00:00:00Z", opts.clockStart)
+		}
+		opts.clock.start = opts.clock.start.Local()
+	}
+	if opts.clockSpeed <= 0 {
+		return fmt.Errorf("-clock-speed %g: must be positive", opts.clockSpeed)
+	}
+	if opts.conn.reconnect < 0 {
+		return fmt.Errorf("-reconnect-after %d: must not be negative", opts.conn.reconnect)
+	}
+	if opts.conn.perConn < 0 {
+		return fmt.Errorf("-resources-per-connection %d: must not be negative", opts.conn.perConn)
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+
+	var pointFlags uint32
+	if opts.points.flags != "" {
+		pointFlags, err = parseDataPointFlags(opts.points.flags)
+		if err != nil {
+			return fmt.Errorf("-data-point-flags: %w", err)
+		}
+		if opts.points.flagged < 0 || opts.points.flagged > 1 {
+			return fmt.Errorf("-data-point-flags-fraction %g: must be between 0 and 1", opts.points.flagged)
+		}
+	}
+	switch opts.points.order {
+	case orderSorted, orderReverse, orderShuffle:
+	default:
+		return fmt.Errorf("-attribute-order %q: must be %s, %s or %s", opts.points.order, orderSorted, orderReverse, orderShuffle)
+	}
+	switch opts.metricOrder {
+	case metricOrderSDK, metricOrderName, orderReverse, orderShuffle:
+	default:
+		return fmt.Errorf("-metric-order %q: must be %s, %s, %s or %s", opts.metricOrder, metricOrderSDK, metricOrderName, orderReverse, orderShuffle)
+	}
+	if pointFlags != 0 || opts.points.order != orderSorted {
+		opts.points.rewrite = newRewriter(pointFlags, opts.points.flagged, opts.points.order, opts.seed)
+	}
+	if opts.corrupt.probability < 0 || opts.corrupt.probability > 1 {
+		return fmt.Errorf("-corrupt-probability %g: must be between 0 and 1", opts.corrupt.probability)
+	}
+	switch opts.corrupt.mode {
+	case corruptTruncate, corruptGzip:
+	default:
+		return fmt.Errorf("-corrupt-mode %q: must be %s or %s", opts.corrupt.mode, corruptTruncate, corruptGzip)
+	}
+	if opts.corrupt.probability > 0 {
+		if opts.protocol == protocolKafka || opts.protocol == protocolStdout {
+			return fmt.Errorf("-corrupt-probability: cannot be combined with -protocol %s", opts.protocol)
+		} else if opts.corrupt.mode == corruptGzip && !opts.useHTTP {
+			return fmt.Errorf("-corrupt-mode %s: requires -protocol %s", corruptGzip, protocolHTTP)
+		}
+		opts.corrupt.corrupter = newCorrupter(opts.corrupt.mode, opts.corrupt.probability, opts.seed)
+	}
+	if opts.interceptors.failProb < 0 || opts.interceptors.failProb > 1 {
+		return fmt.Errorf("-grpc-fail-probability %g: must be between 0 and 1", opts.interceptors.failProb)
+	}
+	if opts.interceptors.names != "" {
+		names, err := parseInterceptors(opts.interceptors.names)
+		if err != nil {
+			return fmt.Errorf("-grpc-interceptors: %w", err)
+		} else if opts.protocol != protocolGRPC {
+			return fmt.Errorf("-grpc-interceptors: requires -protocol %s", protocolGRPC)
+		} else if slices.Contains(names, interceptorFail) != (opts.interceptors.failProb > 0) {
+			return fmt.Errorf("-grpc-fail-probability: the %s interceptor requires it and vice versa", interceptorFail)
+		}
+		opts.interceptors.chain = newInterceptorChain(names, opts.interceptors.failProb, opts.seed)
+	} else if opts.interceptors.failProb > 0 {
+		return fmt.Errorf("-grpc-fail-probability: requires -grpc-interceptors %s", interceptorFail)
+	}
+	if opts.malformed.probability < 0 || opts.malformed.probability > 1 {
+		return fmt.Errorf("-malformed-probability %g: must be between 0 and 1", opts.malformed.probability)
+	}
+	switch opts.malformed.mode {
+	case malformedResource, malformedScope:
+	default:
+		return fmt.Errorf("-malformed-mode %q: must be %s or %s", opts.malformed.mode, malformedResource, malformedScope)
+	}
+	if opts.restamp && opts.replayFile == "" {
+		return fmt.Errorf("-replay-restamp: requires -replay-file")
+	} else if opts.replayFile != "" && !opts.restamp && !opts.clock.realTime() {
+		return fmt.Errorf("-clock-start and -clock-speed: -replay-file requires -replay-restamp, the replayed data points keep their timestamps")
+	}
+	if opts.golden {
+		if opts.endpoint == "" {
+			return fmt.Errorf("-golden: requires an -endpoint")
+		} else if opts.replayFile != "" {
+			return fmt.Errorf("-golden: cannot be combined with -replay-file")
+		} else if !opts.clock.realTime() {
+			return fmt.Errorf("-golden: cannot be combined with -clock-start or -clock-speed, the dataset is sent unchanged")
+		} else if opts.points.rewrite != nil || opts.corrupt.corrupter != nil || opts.malformed.probability > 0 {
+			return fmt.Errorf("-golden: cannot be combined with -data-point-flags, -attribute-order, -corrupt-probability or -malformed-probability, the dataset is sent unchanged")
+		}
+	}
+	if opts.replayFile != "" {
+		if opts.endpoint == "" {
+			return fmt.Errorf("-replay-file: requires an -endpoint")
+		} else if opts.malformed.probability > 0 {
+			return fmt.Errorf("-replay-file: cannot be combined with -malformed-probability")
+		}
+	}
+	return nil
+}
+
+// metricKinds are the kinds of metrics in a config, which some flags
+// require or cannot be combined with.
+type metricKinds struct {
+	counters       bool
+	upDownCounters bool
+	gauges         bool
+	histograms     bool
+	timestamps     bool
+	lifetimes      bool
+}
+
+// validateConfig checks the flags that depend on the config with the kinds
+// of its metrics, and derives the settings that depend on its interval.
+func (opts *options) validateConfig(cfg config, kinds metricKinds) error {
+	interval := time.Duration(cfg.Interval) * time.Second
+	if opts.points.duplicates < 0 || opts.points.duplicates > 1 {
+		return fmt.Errorf("-duplicate-points %g: must be between 0 and 1", opts.points.duplicates)
+	}
+	if opts.negative < 0 || opts.negative > 1 {
+		return fmt.Errorf("-inject-negative-deltas %g: must be between 0 and 1", opts.negative)
+	} else if opts.negative > 0 && !kinds.counters {
+		return fmt.Errorf("-inject-negative-deltas: requires counter metrics")
+	}
+	if opts.burst.series > 0 && !kinds.gauges {
+		return fmt.Errorf("-burst-series: bursts are only supported for gauges")
+	}
+	if opts.newSeries.perInterval > 0 && !kinds.gauges {
+		return fmt.Errorf("-new-series-per-interval: new series are only supported for gauges")
+	}
+	if opts.stale.fraction > 0 && !kinds.gauges {
+		return fmt.Errorf("-stale-fraction: staleness markers are only supported for gauges")
+	}
+	if opts.delta.gauges && opts.stale.fraction > 0 {
+		return fmt.Errorf("-delta-gauges: cannot be combined with -stale-fraction")
+	} else if opts.delta.gauges && kinds.upDownCounters {
+		return fmt.Errorf("-delta-gauges: cannot be combined with %s metrics", metricUpDownCounter)
+	}
+	if kinds.timestamps && opts.delta.gauges {
+		return fmt.Errorf("-delta-gauges: cannot be combined with pattern %s, the change of the time is the interval", patternTimestamp)
+	} else if kinds.timestamps && opts.replay {
+		return fmt.Errorf("-replay: cannot be combined with pattern %s, the replayed values are not the time they are sent", patternTimestamp)
+	}
+	if kinds.lifetimes && opts.replay {
+		return fmt.Errorf("-replay: cannot be combined with a metric lifetime, the snapshot is replayed forever")
+	}
+	if opts.churn.rate < 0 {
+		return fmt.Errorf("-resource-churn-rate %g: must not be negative", opts.churn.rate)
+	} else if opts.churn.rate > 0 && opts.single {
+		return fmt.Errorf("-resource-churn-rate: cannot be combined with -single-resource, there is only one resource")
+	} else if opts.churn.rate > 0 && opts.replay {
+		return fmt.Errorf("-resource-churn-rate: cannot be combined with -replay, the snapshot keeps its resource")
+	} else if opts.churn.rate > 0 && (opts.churn.key == "" || opts.churn.key == string(semconv.ServiceNameKey)) {
+		return fmt.Errorf("-resource-churn-attribute %q: must be a key other than %s", opts.churn.key, semconv.ServiceNameKey)
+	} else if opts.churn.rate > 0 && slices.ContainsFunc(cfg.ResourceAttributes, func(a attributeConfig) bool { return a.key() == opts.churn.key }) {
+		return fmt.Errorf("-resource-churn-attribute %s: is one of the resourceAttributes, make it change with changeEvery or changeProbability instead", opts.churn.key)
+	}
+	if opts.sequence && opts.stale.fraction > 0 {
+		return fmt.Errorf("-sequence-numbers: cannot be combined with -stale-fraction")
+	}
+	if opts.conflicting && opts.negative > 0 {
+		return fmt.Errorf("-conflicting-types: cannot be combined with -inject-negative-deltas")
+	}
+	if opts.delta.fraction < 0 || opts.delta.fraction > 1 {
+		return fmt.Errorf("-delta-fraction %g: must be between 0 and 1", opts.delta.fraction)
+	} else if opts.delta.fraction > 0 && !kinds.counters && !kinds.histograms {
+		return fmt.Errorf("-delta-fraction: requires %s or %s metrics", metricCounter, metricHistogram)
+	} else if opts.delta.fraction > 0 && opts.single {
+		return fmt.Errorf("-delta-fraction: cannot be combined with -single-resource, one service exports all metrics")
+	}
+	if opts.flap.fraction > 0 && opts.single {
+		return fmt.Errorf("-flap-fraction: cannot be combined with -single-resource, one service exports all metrics")
+	}
+	switch opts.reader.mode {
+	case readerManual:
+		if opts.reader.every != 0 {
+			return fmt.Errorf("-export-interval: requires -reader %s", readerPeriodic)
+		}
+	case readerPeriodic:
+		if opts.reader.every < 0 {
+			return fmt.Errorf("-export-interval %s: must not be negative", opts.reader.every)
+		}
+		opts.reader.every = cmp.Or(opts.reader.every, interval)
+		// These take over the collection or the export, which the periodic
+		// reader owns.
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"-replay", opts.replay},
+			{"-benchmark", opts.benchmark},
+			{"-estimate-bandwidth", opts.estimate},
+			{"-max-points-per-request", opts.maxPoints > 0},
+			{"-requests-per-interval", opts.requests > 0},
+			{"-max-inflight", opts.inflight.max > 0},
+			{"-chaos-probability", opts.chaos.probability > 0},
+			{"-chaos-every", opts.chaos.every > 0},
+			{"-flap-fraction", opts.flap.fraction > 0},
+			{"-reconnect-after", opts.conn.reconnect > 0},
+			{"-skip-empty-exports", opts.skipEmpty},
+			{"-duplicate-points", opts.points.duplicates > 0},
+			{"-malformed-probability", opts.malformed.probability > 0},
+			{"a metric lifetime", kinds.lifetimes},
+		} {
+			if f.set {
+				return fmt.Errorf("-reader %s: cannot be combined with %s", readerPeriodic, f.name)
+			}
+		}
+	default:
+		return fmt.Errorf("-reader %q: must be %s or %s", opts.reader.mode, readerManual, readerPeriodic)
+	}
+	if opts.rampStep < 0 {
+		return fmt.Errorf("-payload-ramp %d: must not be negative", opts.rampStep)
+	} else if opts.rampStep > 0 {
+		if opts.endpoint == "" {
+			return fmt.Errorf("-payload-ramp: requires an -endpoint")
+		} else if opts.estimate {
+			return fmt.Errorf("-payload-ramp: cannot be combined with -estimate-bandwidth")
+		}
+		if opts.points.rewrite == nil {
+			opts.points.rewrite = newRewriter(0, 0, orderSorted, opts.seed)
+		}
+		// The ramp stops the run once the context exists.
+		opts.points.rewrite.ramp = newPayloadRamp(opts.rampStep, interval, nil)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultOptions returns the options of the flag defaults that validate
+// checks.
+func defaultOptions() options {
+	return options{
+		endpoint:    "localhost:4317",
+		presence:    1,
+		valueMode:   valuesShared,
+		clockSpeed:  1,
+		metricOrder: metricOrderSDK,
+		points:      pointOptions{order: orderSorted, flagged: 1},
+		corrupt:     corruptOptions{mode: corruptTruncate},
+		malformed:   malformedOptions{mode: malformedResource},
+		reader:      readerOptions{mode: readerManual},
+		newSeries:   newSeriesOptions{lifetime: 1},
+		flap:        flapOptions{period: time.Minute},
+		kafka:       kafkaOptions{brokers: "localhost:9092", topic: "otlp_metrics"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	opts := defaultOptions()
+	require.NoError(t, opts.validate())
+	assert.Equal(t, protocolGRPC, opts.protocol)
+	assert.Equal(t, 1, opts.conn.parallelism)
+	assert.NotZero(t, opts.seed)
+	assert.Nil(t, opts.points.rewrite)
+
+	opts = defaultOptions()
+	opts.protocol = protocolKafka
+	require.NoError(t, opts.validate())
+	assert.Equal(t, "localhost:9092", opts.endpoint)
+
+	for _, test := range []struct {
+		set  func(*options)
+		want string
+	}{
+		{func(o *options) { o.presence = 2 }, "-attribute-presence 2: must be between 0 and 1"},
+		{func(o *options) { o.protocol = "udp" }, `-protocol "udp"`},
+		{func(o *options) { o.useHTTP, o.protocol = true, protocolGRPC }, "-http: cannot be combined with -protocol grpc"},
+		{func(o *options) { o.cardinality.limit = -1 }, "-cardinality-limit -1"},
+		{func(o *options) { o.burst.series = 10 }, "-burst-series: requires -burst-every and -burst-duration"},
+		{func(o *options) { o.chaos.every = 1 }, "-chaos-every: requires -chaos-duration"},
+		{func(o *options) { o.interceptors.failProb = 0.5 }, "-grpc-fail-probability: requires -grpc-interceptors fail"},
+		{func(o *options) { o.golden, o.endpoint = true, "" }, "-golden: requires an -endpoint"},
+	} {
+		opts := defaultOptions()
+		test.set(&opts)
+		assert.ErrorContains(t, opts.validate(), test.want)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg := config{Interval: 10}
+	opts := defaultOptions()
+	opts.reader.mode = readerPeriodic
+	require.NoError(t, opts.validateConfig(cfg, metricKinds{gauges: true}))
+	assert.Equal(t, 10*time.Second, opts.reader.every)
+
+	opts = defaultOptions()
+	opts.burst.series = 10
+	assert.ErrorContains(t, opts.validateConfig(cfg, metricKinds{counters: true}), "-burst-series: bursts are only supported for gauges")
+	opts = defaultOptions()
+	opts.reader.mode = readerPeriodic
+	opts.replay = true
+	assert.ErrorContains(t, opts.validateConfig(cfg, metricKinds{gauges: true}), "-reader periodic: cannot be combined with -replay")
+}
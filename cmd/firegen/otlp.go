@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// jsonlWriter writes collected metrics as newline-delimited OTLP JSON, one
+// MetricsData message per line. It is safe for concurrent use.
+type jsonlWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// rewrite rewrites the written data points like the exported ones.
+	rewrite *rewriter
+}
+
+func (w *jsonlWriter) Write(rm *metricdata.ResourceMetrics) error {
+	pb, err := toMetricsData(rm)
+	if err != nil {
+		return err
+	}
+	w.rewrite.apply(pb.ResourceMetrics)
+	b, err := protojson.Marshal(pb)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.w.Write(append(b, '\n'))
+	return err
+}
+
+// toMetricsData converts collected metrics to their OTLP representation.
+func toMetricsData(rm *metricdata.ResourceMetrics) (*metricspb.MetricsData, error) {
+	out := &metricspb.ResourceMetrics{
+		Resource:  &resourcepb.Resource{Attributes: toKeyValues(rm.Resource.Iter())},
+		SchemaUrl: rm.Resource.SchemaURL(),
+	}
+	for _, sm := range rm.ScopeMetrics {
+		scope := &metricspb.ScopeMetrics{
+			Scope: &commonpb.InstrumentationScope{
+				Name:       sm.Scope.Name,
+				Version:    sm.Scope.Version,
+				Attributes: toKeyValues(sm.Scope.Attributes.Iter()),
+			},
+			SchemaUrl: sm.Scope.SchemaURL,
+		}
+		for _, m := range sm.Metrics {
+			pm, err := toMetric(m)
+			if err != nil {
+				return nil, err
+			}
+			scope.Metrics = append(scope.Metrics, pm)
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, scope)
+	}
+	return &metricspb.MetricsData{ResourceMetrics: []*metricspb.ResourceMetrics{out}}, nil
+}
+
+func toMetric(m metricdata.Metrics) (*metricspb.Metric, error) {
+	out := &metricspb.Metric{
+		Name:        m.Name,
+		Description: m.Description,
+		Unit:        m.Unit,
+	}
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[float64]:
+		out.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: toNumberDataPoints(data.DataPoints),
+		}}
+	case metricdata.Gauge[int64]:
+		out.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: toNumberDataPoints(data.DataPoints),
+		}}
+	case metricdata.Sum[float64]:
+		out.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: toTemporality(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+			DataPoints:             toNumberDataPoints(data.DataPoints),
+		}}
+	case metricdata.Sum[int64]:
+		out.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: toTemporality(data.Temporality),
+			IsMonotonic:            data.IsMonotonic,
+			DataPoints:             toNumberDataPoints(data.DataPoints),
+		}}
+	case metricdata.Histogram[float64]:
+		out.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: toTemporality(data.Temporality),
+			DataPoints:             toHistogramDataPoints(data.DataPoints),
+		}}
+	case metricdata.Histogram[int64]:
+		out.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: toTemporality(data.Temporality),
+			DataPoints:             toHistogramDataPoints(data.DataPoints),
+		}}
+	default:
+		return nil, fmt.Errorf("unsupported data type %T for metric %s", m.Data, m.Name)
+	}
+	return out, nil
+}
+
+func toNumberDataPoints[N int64 | float64](dps []metricdata.DataPoint[N]) []*metricspb.NumberDataPoint {
+	out := make([]*metricspb.NumberDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		ndp := &metricspb.NumberDataPoint{
+			Attributes:        toKeyValues(dp.Attributes.Iter()),
+			StartTimeUnixNano: toUnixNano(dp.StartTime),
+			TimeUnixNano:      toUnixNano(dp.Time),
+		}
+		switch v := any(dp.Value).(type) {
+		case int64:
+			ndp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			ndp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, ndp)
+	}
+	return out
+}
+
+func toHistogramDataPoints[N int64 | float64](dps []metricdata.HistogramDataPoint[N]) []*metricspb.HistogramDataPoint {
+	out := make([]*metricspb.HistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		hdp := &metricspb.HistogramDataPoint{
+			Attributes:        toKeyValues(dp.Attributes.Iter()),
+			StartTimeUnixNano: toUnixNano(dp.StartTime),
+			TimeUnixNano:      toUnixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               &sum,
+			BucketCounts:      dp.BucketCounts,
+			ExplicitBounds:    dp.Bounds,
+		}
+		if v, ok := dp.Min.Value(); ok {
+			lo := float64(v)
+			hdp.Min = &lo
+		}
+		if v, ok := dp.Max.Value(); ok {
+			hi := float64(v)
+			hdp.Max = &hi
+		}
+		out = append(out, hdp)
+	}
+	return out
+}
+
+func toTemporality(t metricdata.Temporality) metricspb.AggregationTemporality {
+	switch t {
+	case metricdata.DeltaTemporality:
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	case metricdata.CumulativeTemporality:
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	default:
+		return metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+	}
+}
+
+func toUnixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(max(0, t.UnixNano()))
+}
+
+func toKeyValues(iter attribute.Iterator) []*commonpb.KeyValue {
+	if iter.Len() == 0 {
+		return nil
+	}
+	out := make([]*commonpb.KeyValue, 0, iter.Len())
+	for iter.Next() {
+		kv := iter.Attribute()
+		out = append(out, &commonpb.KeyValue{Key: string(kv.Key), Value: toAnyValue(kv.Value)})
+	}
+	return out
+}
+
+func toAnyValue(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
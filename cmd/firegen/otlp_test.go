@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestJSONLWriter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attribute.String("service.name", "service-0000")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "firegen-service-0000"},
+			Metrics: []metricdata.Metrics{{
+				Name: "metric-0000",
+				Data: metricdata.Gauge[float64]{
+					DataPoints: []metricdata.DataPoint[float64]{{
+						Attributes: attribute.NewSet(attribute.String("pod", "000000001")),
+						Time:       now,
+						Value:      0.5,
+					}},
+				},
+			}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	w := &jsonlWriter{w: &buf}
+	require.NoError(t, w.Write(rm))
+	require.NoError(t, w.Write(rm))
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var md metricspb.MetricsData
+	require.NoError(t, protojson.Unmarshal(lines[0], &md))
+	require.Len(t, md.ResourceMetrics, 1)
+	res := md.ResourceMetrics[0]
+	assert.Equal(t, "service.name", res.Resource.Attributes[0].Key)
+	assert.Equal(t, "service-0000", res.Resource.Attributes[0].Value.GetStringValue())
+
+	m := res.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "metric-0000", m.Name)
+	dp := m.GetGauge().DataPoints[0]
+	assert.Equal(t, 0.5, dp.GetAsDouble())
+	assert.Equal(t, uint64(now.UnixNano()), dp.TimeUnixNano)
+	assert.Equal(t, "000000001", dp.Attributes[0].Value.GetStringValue())
+}
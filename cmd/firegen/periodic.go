@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	randv2 "math/rand/v2"
+	"sync"
+	"time"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Readers of -reader.
+const (
+	readerManual   = "manual"
+	readerPeriodic = "periodic"
+)
+
+// periodicExporter is the exporter of the PeriodicReader of a service with
+// -reader periodic. The reader decides when to collect and export, so only
+// the parts of the manual export path that apply to every export remain:
+// the virtual clock, the time skew, -metric-order, -cardinality-limit
+// reporting, -out-file and the stats.
+// Without an endpoint exporter is nil and the exports are only counted and
+// written.
+type periodicExporter struct {
+	exporter sdkmetric.Exporter
+	selector sdkmetric.TemporalitySelector
+	service  string
+	output   *jsonlWriter
+	st       *stats
+	opts     options
+
+	// mu guards overflowing, order and totals, the reader exports one
+	// collection at a time but a shutdown flush may overlap an export.
+	mu          sync.Mutex
+	overflowing bool
+	// totals are the counter series of the last export if carry is set,
+	// the shutdown flush leaves them for a resource change to carry over.
+	totals []counterTotal
+	carry  bool
+	// order shuffles the metrics with -metric-order shuffle.
+	order *randv2.Rand
+}
+
+func (e *periodicExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return e.selector(kind)
+}
+
+func (e *periodicExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export sends a collection of the reader. Failures are logged and counted
+// like those of the manual reader and not returned, the SDK would log them
+// a second time.
+func (e *periodicExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if e.carry {
+		e.mu.Lock()
+		e.totals = counterTotals(rm)
+		e.mu.Unlock()
+	}
+	if !e.opts.clock.realTime() {
+		mapTimestamps(rm, e.opts.clock.at)
+	}
+	if e.opts.skew != 0 {
+		skewTimestamps(rm, e.opts.skew)
+	}
+	if e.opts.metricOrder != metricOrderSDK {
+		e.mu.Lock()
+		orderMetrics(rm, e.opts.metricOrder, e.order)
+		e.mu.Unlock()
+	}
+	if e.opts.cardinality.limit > 0 {
+		e.mu.Lock()
+		if n := overflowMetrics(rm); n > 0 && !e.overflowing {
+			e.overflowing = true
+			e.st.overflowing.Add(1)
+			log.Printf("Service %s hit the cardinality limit of %d series in %d metrics, further series are aggregated into otel.metric.overflow", e.service, e.opts.cardinality.limit, n)
+		}
+		e.mu.Unlock()
+	}
+	if e.st.nans.Load() > 0 {
+		e.st.nanSums.Add(int64(nanSums(rm)))
+	}
+	points := countDataPoints(rm)
+	if e.output != nil {
+		if err := e.output.Write(rm); err != nil {
+			log.Printf("Failed to write metrics for %s to %s: %v", e.service, e.opts.outFile, err)
+		}
+	}
+	if e.exporter == nil {
+		e.st.exports.Add(1)
+		e.st.points.Add(int64(points))
+		return nil
+	}
+	t := time.Now()
+	err := e.exporter.Export(ctx, rm)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// The shutdown of the run, not a failed export.
+		return nil
+	}
+	e.st.exports.Add(1)
+	if errors.Is(err, context.DeadlineExceeded) {
+		e.st.failures.Add(1)
+		log.Printf("Timeout after %s exporting metrics for %s", e.opts.timeout, e.service)
+	} else if err != nil {
+		e.st.failures.Add(1)
+		log.Printf("Failed to export metrics for %s: %v", e.service, err)
+	} else {
+		e.st.points.Add(int64(points))
+		infoLog.Printf("Exported %d data points for %s in %dms", points, e.service, time.Since(t).Milliseconds())
+	}
+	return nil
+}
+
+func (e *periodicExporter) ForceFlush(ctx context.Context) error {
+	if e.exporter == nil {
+		return nil
+	}
+	return e.exporter.ForceFlush(ctx)
+}
+
+// Shutdown does not shut down the exporter, which outlives the reader when
+// a resource change replaces the meter provider. The service shuts it down
+// when it ends.
+func (e *periodicExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// failingExporter fails every export with err.
+type failingExporter struct {
+	sdkmetric.Exporter
+	err error
+}
+
+func (e *failingExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.err
+}
+
+func (e *failingExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+func TestPeriodicExporter(t *testing.T) {
+	ctx := context.Background()
+	var st stats
+	exporter := &periodicExporter{selector: temporality, service: "service-0000", st: &st, opts: options{timeout: time.Second}}
+	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(time.Hour))
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	record, err := newInstrument(provider.Meter("test"), metricConfig{Name: "gauge"})
+	require.NoError(t, err)
+
+	record(ctx, 1, metric.WithAttributes())
+	require.NoError(t, provider.ForceFlush(ctx))
+	assert.Equal(t, int64(1), st.exports.Load())
+	assert.Equal(t, int64(1), st.points.Load())
+
+	exporter.exporter = &failingExporter{err: errors.New("unavailable")}
+	record(ctx, 1, metric.WithAttributes())
+	require.NoError(t, provider.ForceFlush(ctx))
+	assert.Equal(t, int64(2), st.exports.Load())
+	assert.Equal(t, int64(1), st.failures.Load())
+
+	// The shutdown flushes the last recording but leaves the exporter, which
+	// the service shuts down.
+	exporter.exporter = nil
+	record(ctx, 1, metric.WithAttributes())
+	require.NoError(t, provider.Shutdown(ctx))
+	assert.Equal(t, int64(3), st.exports.Load())
+	assert.Equal(t, int64(2), st.points.Load())
+}
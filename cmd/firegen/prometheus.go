@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// scrapeTarget serves the series of all services on a Prometheus scrape
+// endpoint. Every service registers with a registry of its own, so a
+// service that replaces its provider drops the series of the old one.
+type scrapeTarget struct {
+	mu         sync.Mutex
+	registries map[string]*prometheus.Registry
+}
+
+func newScrapeTarget() *scrapeTarget {
+	return &scrapeTarget{registries: make(map[string]*prometheus.Registry)}
+}
+
+// reader returns the reader that exposes the metrics of a service on the
+// scrape endpoint, replacing the previous reader of the service. The
+// service name becomes a label of every series, since Prometheus series
+// have no resource to tell the services apart.
+func (s *scrapeTarget) reader(serviceName string) (sdkmetric.Reader, error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprom.New(
+		otelprom.WithRegisterer(registry),
+		otelprom.WithResourceAsConstantLabels(attribute.NewAllowKeysFilter(semconv.ServiceNameKey)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.registries[serviceName] = registry
+	s.mu.Unlock()
+	return exporter, nil
+}
+
+// reset drops the series of all services, which register again when they
+// restart.
+func (s *scrapeTarget) reset() {
+	s.mu.Lock()
+	clear(s.registries)
+	s.mu.Unlock()
+}
+
+// Gather implements prometheus.Gatherer by merging the metric families of
+// all services.
+func (s *scrapeTarget) Gather() ([]*dto.MetricFamily, error) {
+	s.mu.Lock()
+	gatherers := make(prometheus.Gatherers, 0, len(s.registries))
+	for _, registry := range s.registries {
+		gatherers = append(gatherers, registry)
+	}
+	s.mu.Unlock()
+	return gatherers.Gather()
+}
+
+// serve serves the scrape endpoint at /metrics on addr until ctx is done.
+// It only returns an error if addr cannot be listened on.
+func (s *scrapeTarget) serve(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(s, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Failed to serve Prometheus scrape endpoint: %v", err)
+		}
+	}()
+	return nil
+}
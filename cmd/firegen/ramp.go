@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// paddingKey is the resource attribute -payload-ramp pads the exports with.
+const paddingKey = "firegen.padding"
+
+// payloadRamp grows the exports of -payload-ramp to find the request size
+// a collector starts rejecting. The resources are padded with an attribute
+// that grows by step bytes every interval, and the outcome of every request
+// is recorded by its size. The first rejected request ends the run. It is
+// safe for concurrent use.
+type payloadRamp struct {
+	step     int
+	start    time.Time
+	interval time.Duration
+	// stop ends the run.
+	stop func()
+
+	mu sync.Mutex
+	// accepted is the size of the largest accepted request, rejected the
+	// size of the first rejected one and err why, 0 while none was.
+	accepted int
+	rejected int
+	err      error
+}
+
+func newPayloadRamp(step int, interval time.Duration, stop func()) *payloadRamp {
+	return &payloadRamp{step: step, start: time.Now(), interval: interval, stop: stop}
+}
+
+// padding returns the number of bytes the resources are padded with now.
+func (p *payloadRamp) padding() int {
+	return p.step * (1 + int(time.Since(p.start)/p.interval))
+}
+
+// pad adds the current padding to the resources of rms.
+func (p *payloadRamp) pad(rms []*metricspb.ResourceMetrics) {
+	value := &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: strings.Repeat("x", p.padding())}}
+	for _, rm := range rms {
+		if rm.Resource != nil {
+			rm.Resource.Attributes = append(rm.Resource.Attributes, &commonpb.KeyValue{Key: paddingKey, Value: value})
+		}
+	}
+}
+
+// record records the outcome of a request of size bytes. Requests
+// canceled by the end of the run are not counted.
+func (p *payloadRamp) record(size int, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.accepted = max(p.accepted, size)
+		return
+	}
+	if p.rejected > 0 {
+		return
+	}
+	p.rejected, p.err = size, err
+	log.Printf("Payload ramp: request of %s rejected, stopping: %v", formatBytes(float64(size)), err)
+	p.stop()
+}
+
+// result returns the sizes of the largest accepted and of the first
+// rejected request, and why it was rejected.
+func (p *payloadRamp) result() (accepted, rejected int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.accepted, p.rejected, p.err
+}
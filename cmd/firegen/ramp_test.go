@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestPayloadRamp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if len(body) > 2500 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	defer server.Close()
+
+	stopped := false
+	ramp := newPayloadRamp(1000, time.Minute, func() { stopped = true })
+	rewrite := newRewriter(0, 0, orderSorted, 1)
+	rewrite.ramp = ramp
+	opts := options{
+		endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		useHTTP:   true,
+		plaintext: true,
+		points:    pointOptions{rewrite: rewrite},
+	}
+	ctx := context.Background()
+	exporter, err := opts.newExporter(ctx)
+	require.NoError(t, err)
+	defer exporter.Shutdown(ctx)
+
+	rm := &metricdata.ResourceMetrics{Resource: resource.Empty()}
+	for i := range 3 {
+		ramp.start = time.Now().Add(-time.Duration(i) * time.Minute)
+		err := exporter.Export(ctx, rm)
+		assert.Equal(t, i == 2, err != nil, "export %d: %v", i, err)
+	}
+	accepted, rejected, err := ramp.result()
+	assert.Greater(t, accepted, 2000)
+	assert.LessOrEqual(t, accepted, 2500)
+	assert.Greater(t, rejected, 3000)
+	assert.ErrorContains(t, err, "413")
+	assert.True(t, stopped)
+}
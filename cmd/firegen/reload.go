@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// reloadChanges compares the reloaded config next with the running config
+// cfg, both as written, and returns the changes -reload-on-sighup applies,
+// of the number of services and the interval, and whether next changes any
+// other setting, which takes a restart.
+func reloadChanges(cfg, next config) (changes []string, others bool, err error) {
+	services, nextServices := max(1, cfg.Services), max(1, next.Services)
+	if nextServices != services {
+		if len(cfg.Tenants) > 0 {
+			return nil, false, fmt.Errorf("services cannot change with tenants, which split the services")
+		}
+		changes = append(changes, fmt.Sprintf("services %d -> %d", services, nextServices))
+	}
+	interval, nextInterval := max(1, cfg.Interval), max(1, next.Interval)
+	if nextInterval != interval {
+		changes = append(changes, fmt.Sprintf("interval %s -> %s", time.Duration(interval)*time.Second, time.Duration(nextInterval)*time.Second))
+	}
+	next.Services, next.Interval = cfg.Services, cfg.Interval
+	return changes, !reflect.DeepEqual(cfg, next), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadChanges(t *testing.T) {
+	cfg := config{Services: 2, Interval: 10, Attributes: []attributeConfig{{Name: "a", Cardinality: 2}}}
+
+	changes, others, err := reloadChanges(cfg, cfg)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.False(t, others)
+
+	next := cfg
+	next.Services, next.Interval = 5, 0
+	changes, others, err = reloadChanges(cfg, next)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"services 2 -> 5", "interval 10s -> 1s"}, changes)
+	assert.False(t, others)
+
+	next = cfg
+	next.Attributes = []attributeConfig{{Name: "a", Cardinality: 3}}
+	changes, others, err = reloadChanges(cfg, next)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.True(t, others)
+
+	cfg.Tenants = []tenantConfig{{Name: "t"}}
+	next = cfg
+	next.Services = 3
+	_, _, err = reloadChanges(cfg, next)
+	assert.Error(t, err)
+	next.Services, next.Interval = cfg.Services, 5
+	changes, _, err = reloadChanges(cfg, next)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"interval 10s -> 5s"}, changes)
+}
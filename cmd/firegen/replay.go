@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// replayFile sends the exports recorded in an OTLP JSON lines file, as
+// written by -out-file, to the endpoint until ctx is done, starting over at
+// the end of the file. The file is streamed line by line, and the exports
+// are paced like they were recorded, by the latest timestamp of each line.
+// With restamp the timestamps of every export are shifted so that its
+// latest one is the event time of the virtual clock when it is sent.
+func replayFile(ctx context.Context, opts options, path string, restamp bool, st *stats) error {
+	exporter, err := opts.connect(ctx, "replay")
+	if err != nil {
+		return err
+	}
+	defer exporter.Shutdown(context.WithoutCancel(ctx))
+
+	for loop := 0; ctx.Err() == nil; loop++ {
+		n, err := replayOnce(ctx, path, func(rm *metricdata.ResourceMetrics) {
+			if restamp {
+				skewTimestamps(rm, opts.clock.now().Sub(latestTime(rm)))
+			}
+			exportCtx, cancel := context.WithTimeout(ctx, opts.timeout)
+			err := exporter.Export(exportCtx, rm)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			st.exports.Add(1)
+			if err != nil {
+				st.failures.Add(1)
+				log.Printf("Failed to export replayed metrics: %v", err)
+				return
+			}
+			st.points.Add(int64(countDataPoints(rm)))
+		})
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return fmt.Errorf("%s contains no metrics", path)
+		}
+		if ctx.Err() == nil {
+			infoLog.Printf("Replayed %s %d times, %d exports, %d data points, %d failed exports",
+				path, loop+1, st.exports.Load(), st.points.Load(), st.failures.Load())
+		}
+	}
+	return nil
+}
+
+// replayOnce streams the exports of the file to export, and returns the
+// number of exports.
+func replayOnce(ctx context.Context, path string, export func(*metricdata.ResourceMetrics)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	start := time.Now()
+	var first time.Time
+	n := 0
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if len(b) > 1 {
+			var md metricspb.MetricsData
+			if err := protojson.Unmarshal(b, &md); err != nil {
+				return n, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			rms, err := fromMetricsData(&md)
+			if err != nil {
+				return n, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			for i := range rms {
+				rm := &rms[i]
+				if t := latestTime(rm); !t.IsZero() {
+					if first.IsZero() {
+						first = t
+					}
+					select {
+					case <-ctx.Done():
+						return n, nil
+					case <-time.After(time.Until(start.Add(t.Sub(first)))):
+					}
+				}
+				export(rm)
+				n++
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// latestTime returns the latest data point timestamp in rm, zero if it has
+// none.
+func latestTime(rm *metricdata.ResourceMetrics) time.Time {
+	var latest time.Time
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			forEachTime(m, func(t time.Time) {
+				if t.After(latest) {
+					latest = t
+				}
+			})
+		}
+	}
+	return latest
+}
+
+func forEachTime(m metricdata.Metrics, f func(time.Time)) {
+	switch data := m.Data.(type) {
+	case metricdata.Gauge[float64]:
+		for _, dp := range data.DataPoints {
+			f(dp.Time)
+		}
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			f(dp.Time)
+		}
+	case metricdata.Sum[float64]:
+		for _, dp := range data.DataPoints {
+			f(dp.Time)
+		}
+	case metricdata.Sum[int64]:
+		for _, dp := range data.DataPoints {
+			f(dp.Time)
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range data.DataPoints {
+			f(dp.Time)
+		}
+	}
+}
+
+// fromMetricsData converts OTLP metrics to their SDK representation, the
+// inverse of toMetricsData. Exemplars, data point flags and resource
+// entity references are dropped.
+func fromMetricsData(md *metricspb.MetricsData) ([]metricdata.ResourceMetrics, error) {
+	var out []metricdata.ResourceMetrics
+	for _, prm := range md.ResourceMetrics {
+		rm := metricdata.ResourceMetrics{
+			Resource: resource.NewWithAttributes(prm.SchemaUrl, fromKeyValues(prm.GetResource().GetAttributes())...),
+		}
+		for _, psm := range prm.ScopeMetrics {
+			sm := metricdata.ScopeMetrics{
+				Scope: instrumentation.Scope{
+					Name:      psm.GetScope().GetName(),
+					Version:   psm.GetScope().GetVersion(),
+					SchemaURL: psm.SchemaUrl,
+				},
+			}
+			if attrs := psm.GetScope().GetAttributes(); len(attrs) > 0 {
+				sm.Scope.Attributes = attribute.NewSet(fromKeyValues(attrs)...)
+			}
+			for _, pm := range psm.Metrics {
+				m, err := fromMetric(pm)
+				if err != nil {
+					return nil, err
+				}
+				sm.Metrics = append(sm.Metrics, m)
+			}
+			rm.ScopeMetrics = append(rm.ScopeMetrics, sm)
+		}
+		out = append(out, rm)
+	}
+	return out, nil
+}
+
+func fromMetric(pm *metricspb.Metric) (metricdata.Metrics, error) {
+	m := metricdata.Metrics{Name: pm.Name, Description: pm.Description, Unit: pm.Unit}
+	switch data := pm.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		m.Data = metricdata.Gauge[float64]{DataPoints: fromNumberDataPoints(data.Gauge.DataPoints)}
+	case *metricspb.Metric_Sum:
+		m.Data = metricdata.Sum[float64]{
+			Temporality: fromTemporality(data.Sum.AggregationTemporality),
+			IsMonotonic: data.Sum.IsMonotonic,
+			DataPoints:  fromNumberDataPoints(data.Sum.DataPoints),
+		}
+	case *metricspb.Metric_Histogram:
+		m.Data = metricdata.Histogram[float64]{
+			Temporality: fromTemporality(data.Histogram.AggregationTemporality),
+			DataPoints:  fromHistogramDataPoints(data.Histogram.DataPoints),
+		}
+	default:
+		return m, fmt.Errorf("unsupported data type %T for metric %s", pm.Data, pm.Name)
+	}
+	return m, nil
+}
+
+// fromNumberDataPoints converts number data points to float64 ones, the
+// SDK representation does not allow mixing integer and double values.
+func fromNumberDataPoints(pdps []*metricspb.NumberDataPoint) []metricdata.DataPoint[float64] {
+	out := make([]metricdata.DataPoint[float64], 0, len(pdps))
+	for _, pdp := range pdps {
+		dp := metricdata.DataPoint[float64]{
+			Attributes: attribute.NewSet(fromKeyValues(pdp.Attributes)...),
+			StartTime:  fromUnixNano(pdp.StartTimeUnixNano),
+			Time:       fromUnixNano(pdp.TimeUnixNano),
+			Value:      pdp.GetAsDouble(),
+		}
+		if v, ok := pdp.Value.(*metricspb.NumberDataPoint_AsInt); ok {
+			dp.Value = float64(v.AsInt)
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func fromHistogramDataPoints(pdps []*metricspb.HistogramDataPoint) []metricdata.HistogramDataPoint[float64] {
+	out := make([]metricdata.HistogramDataPoint[float64], 0, len(pdps))
+	for _, pdp := range pdps {
+		dp := metricdata.HistogramDataPoint[float64]{
+			Attributes:   attribute.NewSet(fromKeyValues(pdp.Attributes)...),
+			StartTime:    fromUnixNano(pdp.StartTimeUnixNano),
+			Time:         fromUnixNano(pdp.TimeUnixNano),
+			Count:        pdp.Count,
+			Sum:          pdp.GetSum(),
+			BucketCounts: pdp.BucketCounts,
+			Bounds:       pdp.ExplicitBounds,
+		}
+		if pdp.Min != nil {
+			dp.Min = metricdata.NewExtrema(*pdp.Min)
+		}
+		if pdp.Max != nil {
+			dp.Max = metricdata.NewExtrema(*pdp.Max)
+		}
+		out = append(out, dp)
+	}
+	return out
+}
+
+func fromTemporality(t metricspb.AggregationTemporality) metricdata.Temporality {
+	switch t {
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return metricdata.DeltaTemporality
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return metricdata.CumulativeTemporality
+	default:
+		return metricdata.Temporality(0)
+	}
+}
+
+func fromUnixNano(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
+
+// fromKeyValues converts OTLP attributes. Array and map values, which
+// firegen does not generate, are kept as their JSON encoding.
+func fromKeyValues(kvs []*commonpb.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		key := attribute.Key(kv.Key)
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			out = append(out, key.String(v.StringValue))
+		case *commonpb.AnyValue_BoolValue:
+			out = append(out, key.Bool(v.BoolValue))
+		case *commonpb.AnyValue_IntValue:
+			out = append(out, key.Int64(v.IntValue))
+		case *commonpb.AnyValue_DoubleValue:
+			out = append(out, key.Float64(v.DoubleValue))
+		default:
+			b, _ := protojson.Marshal(kv.GetValue())
+			out = append(out, key.String(string(b)))
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+func TestReplayOnce(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rm := metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attribute.String("service.name", "service-0000")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "firegen-service-0000"},
+			Metrics: []metricdata.Metrics{{
+				Name: "metric-0000",
+				Data: metricdata.Gauge[float64]{
+					DataPoints: []metricdata.DataPoint[float64]{{
+						Attributes: attribute.NewSet(attribute.String("pod", "000000001")),
+						Time:       now,
+						Value:      0.5,
+					}},
+				},
+			}, {
+				Name: "metric-0001",
+				Data: metricdata.Sum[float64]{
+					Temporality: metricdata.CumulativeTemporality,
+					IsMonotonic: true,
+					DataPoints: []metricdata.DataPoint[float64]{{
+						Attributes: attribute.NewSet(attribute.Int("shard", 3)),
+						StartTime:  now.Add(-time.Minute),
+						Time:       now,
+						Value:      42,
+					}},
+				},
+			}, {
+				Name: "metric-0002",
+				Data: metricdata.Histogram[float64]{
+					Temporality: metricdata.DeltaTemporality,
+					DataPoints: []metricdata.HistogramDataPoint[float64]{{
+						Attributes:   attribute.NewSet(attribute.Bool("ok", true)),
+						StartTime:    now.Add(-time.Minute),
+						Time:         now,
+						Count:        3,
+						Sum:          6,
+						Bounds:       []float64{1, 5},
+						BucketCounts: []uint64{1, 1, 1},
+						Min:          metricdata.NewExtrema(0.5),
+						Max:          metricdata.NewExtrema(4.5),
+					}},
+				},
+			}},
+		}},
+	}
+
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := &jsonlWriter{w: f}
+	require.NoError(t, w.Write(&rm))
+	require.NoError(t, w.Write(&rm))
+	require.NoError(t, f.Close())
+
+	var replayed []metricdata.ResourceMetrics
+	n, err := replayOnce(context.Background(), path, func(rm *metricdata.ResourceMetrics) {
+		replayed = append(replayed, *rm)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for _, got := range replayed {
+		metricdatatest.AssertEqual(t, rm, got)
+	}
+	assert.Equal(t, now, latestTime(&replayed[0]))
+
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"), 0o644))
+	_, err = replayOnce(context.Background(), path, func(*metricdata.ResourceMetrics) {})
+	assert.ErrorContains(t, err, "metrics.jsonl:1")
+}
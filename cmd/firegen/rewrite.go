@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// dataPointFlagNames are the data point flags -data-point-flags accepts by
+// name.
+var dataPointFlagNames = map[string]uint32{
+	"no-recorded-value": uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK),
+}
+
+// parseDataPointFlags parses a comma-separated list of flag names or
+// numeric masks, e.g. no-recorded-value or 0x2 for flags without a name,
+// into the flags field of OTLP data points.
+func parseDataPointFlags(s string) (uint32, error) {
+	var flags uint32
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if mask, ok := dataPointFlagNames[name]; ok {
+			flags |= mask
+			continue
+		}
+		mask, err := strconv.ParseUint(name, 0, 32)
+		if err != nil || mask == 0 {
+			return 0, fmt.Errorf("unknown flag %q", name)
+		}
+		flags |= uint32(mask)
+	}
+	return flags, nil
+}
+
+// Attribute orders of -attribute-order.
+const (
+	orderSorted  = "sorted"
+	orderReverse = "reverse"
+	orderShuffle = "shuffle"
+)
+
+// rewriter post-processes the OTLP messages of the exports for what the SDK
+// cannot express: it sets data point flags, which metricdata cannot carry,
+// reorders the data point attributes, which attribute sets keep sorted by
+// key, and adds entity references to the resources, which the SDK does not
+// support yet. With -payload-ramp it also pads the resources and records
+// the outcome of the requests. The messages are rewritten after the exporters convert the
+// metrics, with a gRPC interceptor or an HTTP transport. It is safe for
+// concurrent use.
+type rewriter struct {
+	// flags are set on a fraction of the data points.
+	flags    uint32
+	fraction float64
+	// order is the order of the data point attributes, orderSorted keeps
+	// them as they are.
+	order string
+	seed  int64
+	// entities are referenced by the resources with their identifying
+	// attributes.
+	entities []entityConfig
+	// ramp pads the resources and records the outcome of the requests.
+	ramp *payloadRamp
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newRewriter(flags uint32, fraction float64, order string, seed int64) *rewriter {
+	return &rewriter{flags: flags, fraction: fraction, order: order, seed: seed, rng: rand.New(rand.NewSource(seed))}
+}
+
+// apply rewrites the data points of rms. It does nothing on a nil receiver.
+func (r *rewriter) apply(rms []*metricspb.ResourceMetrics) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rewrite := func(flags *uint32, attrs []*commonpb.KeyValue, time uint64) {
+		if r.flags != 0 && (r.fraction >= 1 || r.rng.Float64() < r.fraction) {
+			*flags |= r.flags
+		}
+		r.reorder(attrs, time)
+	}
+	if r.ramp != nil {
+		r.ramp.pad(rms)
+	}
+	for _, rm := range rms {
+		r.addEntityRefs(rm.Resource)
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				switch data := m.Data.(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.DataPoints {
+						rewrite(&dp.Flags, dp.Attributes, dp.TimeUnixNano)
+					}
+				case *metricspb.Metric_Sum:
+					for _, dp := range data.Sum.DataPoints {
+						rewrite(&dp.Flags, dp.Attributes, dp.TimeUnixNano)
+					}
+				case *metricspb.Metric_Histogram:
+					for _, dp := range data.Histogram.DataPoints {
+						rewrite(&dp.Flags, dp.Attributes, dp.TimeUnixNano)
+					}
+				case *metricspb.Metric_ExponentialHistogram:
+					for _, dp := range data.ExponentialHistogram.DataPoints {
+						rewrite(&dp.Flags, dp.Attributes, dp.TimeUnixNano)
+					}
+				case *metricspb.Metric_Summary:
+					for _, dp := range data.Summary.DataPoints {
+						rewrite(&dp.Flags, dp.Attributes, dp.TimeUnixNano)
+					}
+				}
+			}
+		}
+	}
+}
+
+// addEntityRefs adds a reference to each entity whose identifying
+// attributes are all attributes of the resource.
+func (r *rewriter) addEntityRefs(res *resourcepb.Resource) {
+	if len(r.entities) == 0 || res == nil {
+		return
+	}
+	keys := make(map[string]bool, len(res.Attributes))
+	for _, kv := range res.Attributes {
+		keys[kv.Key] = true
+	}
+	for _, entity := range r.entities {
+		if !slices.ContainsFunc(entity.IDKeys, func(key string) bool { return !keys[key] }) {
+			ref := &commonpb.EntityRef{SchemaUrl: entity.SchemaURL, Type: entity.Type, IdKeys: entity.IDKeys}
+			for _, key := range entity.DescriptionKeys {
+				if keys[key] {
+					ref.DescriptionKeys = append(ref.DescriptionKeys, key)
+				}
+			}
+			res.EntityRefs = append(res.EntityRefs, ref)
+		}
+	}
+}
+
+// reorder puts the attributes of a data point in the configured order. The
+// shuffle is derived from the seed, the attributes and the timestamp of the
+// data point, so that it is reproducible independent of the order in which
+// the services export, while a series changes its order between points.
+func (r *rewriter) reorder(attrs []*commonpb.KeyValue, time uint64) {
+	switch r.order {
+	case orderReverse:
+		slices.Reverse(attrs)
+	case orderShuffle:
+		h := fnv.New64a()
+		for _, kv := range attrs {
+			h.Write([]byte(kv.Key))
+			h.Write([]byte{0})
+			h.Write([]byte(kv.GetValue().GetStringValue()))
+			h.Write([]byte{0})
+		}
+		rng := randv2.New(randv2.NewPCG(uint64(r.seed), h.Sum64()^time))
+		rng.Shuffle(len(attrs), func(i, j int) { attrs[i], attrs[j] = attrs[j], attrs[i] })
+	}
+}
+
+// unaryInterceptor rewrites the export requests of the gRPC exporter.
+func (r *rewriter) unaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	export, ok := req.(*colmetricspb.ExportMetricsServiceRequest)
+	if ok {
+		r.apply(export.ResourceMetrics)
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if ok && r.ramp != nil {
+		r.ramp.record(proto.Size(export), err)
+	}
+	return err
+}
+
+// rewriteTransport rewrites the protobuf export requests of the HTTP
+// exporter.
+type rewriteTransport struct {
+	rewriter *rewriter
+	base     http.RoundTripper
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Header.Get("Content-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var pb colmetricspb.ExportMetricsServiceRequest
+	if err := proto.Unmarshal(body, &pb); err != nil {
+		return nil, fmt.Errorf("failed to rewrite export request: %w", err)
+	}
+	t.rewriter.apply(pb.ResourceMetrics)
+	if body, err = proto.Marshal(&pb); err != nil {
+		return nil, fmt.Errorf("failed to rewrite export request: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	resp, err := t.base.RoundTrip(req)
+	if ramp := t.rewriter.ramp; ramp != nil {
+		if err == nil && resp.StatusCode >= 300 {
+			ramp.record(len(body), fmt.Errorf("HTTP status %s", resp.Status))
+		} else {
+			ramp.record(len(body), err)
+		}
+	}
+	return resp, err
+}
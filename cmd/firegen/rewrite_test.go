@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseDataPointFlags(t *testing.T) {
+	flags, err := parseDataPointFlags("no-recorded-value")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), flags)
+
+	flags, err = parseDataPointFlags("no-recorded-value, 0x4")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(5), flags)
+
+	for _, s := range []string{"", "stale", "0", "0x100000000"} {
+		_, err := parseDataPointFlags(s)
+		assert.Error(t, err, "%q", s)
+	}
+}
+
+func TestRewriteTransport(t *testing.T) {
+	requests := make(chan *colmetricspb.ExportMetricsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req colmetricspb.ExportMetricsServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		requests <- &req
+	}))
+	defer server.Close()
+
+	opts := options{
+		endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		useHTTP:   true,
+		plaintext: true,
+		points:    pointOptions{rewrite: newRewriter(1, 1, orderSorted, 1)},
+	}
+	ctx := context.Background()
+	exporter, err := opts.newExporter(ctx)
+	require.NoError(t, err)
+	defer exporter.Shutdown(ctx)
+
+	rm := &metricdata.ResourceMetrics{
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Metrics: []metricdata.Metrics{{
+				Name: "metric-0000",
+				Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{{Time: time.Now(), Value: 1}}},
+			}, {
+				Name: "metric-0001",
+				Data: metricdata.Histogram[float64]{
+					Temporality: metricdata.DeltaTemporality,
+					DataPoints:  []metricdata.HistogramDataPoint[float64]{{Time: time.Now(), Count: 1}},
+				},
+			}},
+		}},
+	}
+	require.NoError(t, exporter.Export(ctx, rm))
+	metrics := (<-requests).ResourceMetrics[0].ScopeMetrics[0].Metrics
+	assert.Equal(t, uint32(1), metrics[0].GetGauge().DataPoints[0].Flags)
+	assert.Equal(t, uint32(1), metrics[1].GetHistogram().DataPoints[0].Flags)
+}
+
+func TestRewriterReorder(t *testing.T) {
+	points := func() []*metricspb.ResourceMetrics {
+		var attrs []*commonpb.KeyValue
+		for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			attrs = append(attrs, &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "000000000"}}})
+		}
+		return []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Metrics: []*metricspb.Metric{{
+					Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+						{Attributes: attrs, TimeUnixNano: 1},
+					}}},
+				}},
+			}},
+		}}
+	}
+	keys := func(rms []*metricspb.ResourceMetrics) string {
+		var keys string
+		for _, kv := range rms[0].ScopeMetrics[0].Metrics[0].GetGauge().DataPoints[0].Attributes {
+			keys += kv.Key
+		}
+		return keys
+	}
+	reordered := func(order string, seed int64) string {
+		rms := points()
+		newRewriter(0, 1, order, seed).apply(rms)
+		return keys(rms)
+	}
+
+	assert.Equal(t, "abcdefgh", reordered(orderSorted, 1))
+	assert.Equal(t, "hgfedcba", reordered(orderReverse, 1))
+
+	shuffled := reordered(orderShuffle, 1)
+	assert.NotEqual(t, "abcdefgh", shuffled)
+	assert.ElementsMatch(t, []byte("abcdefgh"), []byte(shuffled))
+	assert.Equal(t, shuffled, reordered(orderShuffle, 1))
+	assert.NotEqual(t, shuffled, reordered(orderShuffle, 2))
+}
+
+func TestRewriterEntityRefs(t *testing.T) {
+	r := newRewriter(0, 0, orderSorted, 1)
+	r.entities = []entityConfig{
+		{Type: "service", IDKeys: []string{"service.name"}, DescriptionKeys: []string{"service.version", "deployment.environment"}},
+		{Type: "host", IDKeys: []string{"host.name"}},
+	}
+	res := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "service-0000"}}},
+		{Key: "deployment.environment", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "prod"}}},
+	}}
+	r.apply([]*metricspb.ResourceMetrics{{Resource: res}})
+	require.Len(t, res.EntityRefs, 1)
+	assert.Equal(t, "service", res.EntityRefs[0].Type)
+	assert.Equal(t, []string{"service.name"}, res.EntityRefs[0].IdKeys)
+	assert.Equal(t, []string{"deployment.environment"}, res.EntityRefs[0].DescriptionKeys)
+
+	res = &resourcepb.Resource{}
+	newRewriter(0, 0, orderSorted, 1).apply([]*metricspb.ResourceMetrics{{Resource: res}})
+	assert.Empty(t, res.EntityRefs)
+}
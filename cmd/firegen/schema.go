@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// Schema URLs of the resources of -conflicting-schema-urls. The resource
+// starts out with conflictingSchemaURL and merges a detected resource with
+// detectedSchemaURL.
+const (
+	conflictingSchemaURL = semconv.SchemaURL
+	detectedSchemaURL    = "https://opentelemetry.io/schemas/1.26.0"
+)
+
+// schemaConflictDetector detects an empty resource in the schema
+// detectedSchemaURL, which resource.New fails to merge into a resource with
+// a different schema URL.
+type schemaConflictDetector struct{}
+
+func (schemaConflictDetector) Detect(context.Context) (*resource.Resource, error) {
+	return resource.NewWithAttributes(detectedSchemaURL), nil
+}
+
+// schemaConflictOptions returns the resource options that make resource.New
+// merge resources with conflicting schema URLs.
+func schemaConflictOptions() []resource.Option {
+	return []resource.Option{
+		resource.WithSchemaURL(conflictingSchemaURL),
+		resource.WithDetectors(schemaConflictDetector{}),
+	}
+}
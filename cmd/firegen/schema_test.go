@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+func TestSchemaConflictOptions(t *testing.T) {
+	res, err := resource.New(context.Background(), append(schemaConflictOptions(),
+		resource.WithAttributes(semconv.ServiceNameKey.String("service-0000")))...)
+	assert.ErrorIs(t, err, resource.ErrSchemaURLConflict)
+	assert.Empty(t, res.SchemaURL())
+	name, _ := res.Set().Value(semconv.ServiceNameKey)
+	assert.Equal(t, "service-0000", name.AsString())
+}
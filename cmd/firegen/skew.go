@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// skewTimestamps shifts the start and end timestamps of all data points in
+// rm by d, in place.
+func skewTimestamps(rm *metricdata.ResourceMetrics, d time.Duration) {
+	mapTimestamps(rm, func(t time.Time) time.Time { return t.Add(d) })
+}
+
+// mapTimestamps replaces the start and end timestamps of all data points in
+// rm by f of them, in place, leaving the unset gauge start times unset.
+func mapTimestamps(rm *metricdata.ResourceMetrics, f func(time.Time) time.Time) {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[float64]:
+				mapDataPoints(data.DataPoints, f)
+			case metricdata.Gauge[int64]:
+				mapDataPoints(data.DataPoints, f)
+			case metricdata.Sum[float64]:
+				mapDataPoints(data.DataPoints, f)
+			case metricdata.Sum[int64]:
+				mapDataPoints(data.DataPoints, f)
+			case metricdata.Histogram[float64]:
+				mapHistogramDataPoints(data.DataPoints, f)
+			case metricdata.Histogram[int64]:
+				mapHistogramDataPoints(data.DataPoints, f)
+			}
+		}
+	}
+}
+
+func mapDataPoints[N int64 | float64](dps []metricdata.DataPoint[N], f func(time.Time) time.Time) {
+	for i := range dps {
+		dps[i].StartTime = mapTime(dps[i].StartTime, f)
+		dps[i].Time = mapTime(dps[i].Time, f)
+	}
+}
+
+func mapHistogramDataPoints[N int64 | float64](dps []metricdata.HistogramDataPoint[N], f func(time.Time) time.Time) {
+	for i := range dps {
+		dps[i].StartTime = mapTime(dps[i].StartTime, f)
+		dps[i].Time = mapTime(dps[i].Time, f)
+	}
+}
+
+func mapTime(t time.Time, f func(time.Time) time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return f(t)
+}
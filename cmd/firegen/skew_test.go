@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSkewTimestamps(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rm := &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{Metrics: []metricdata.Metrics{
+		{Name: "gauge", Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{{Time: now}}}},
+		{Name: "histogram", Data: metricdata.Histogram[float64]{DataPoints: []metricdata.HistogramDataPoint[float64]{{StartTime: now, Time: now}}}},
+	}}}}
+
+	skewTimestamps(rm, 5*time.Minute)
+	gauge := rm.ScopeMetrics[0].Metrics[0].Data.(metricdata.Gauge[float64]).DataPoints[0]
+	assert.True(t, gauge.StartTime.IsZero())
+	assert.Equal(t, now.Add(5*time.Minute), gauge.Time)
+	histogram := rm.ScopeMetrics[0].Metrics[1].Data.(metricdata.Histogram[float64]).DataPoints[0]
+	assert.Equal(t, now.Add(5*time.Minute), histogram.StartTime)
+	assert.Equal(t, now.Add(5*time.Minute), histogram.Time)
+}
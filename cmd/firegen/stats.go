@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/protobuf/proto"
+)
+
+// stats counts the exports of all services. It is safe for concurrent use.
+type stats struct {
+	exports         atomic.Int64 // export attempts
+	failures        atomic.Int64 // failed export attempts
+	points          atomic.Int64 // data points in successful exports
+	skipped         atomic.Int64 // exports skipped because they had no data points
+	lagging         atomic.Int64 // ticks that took longer than the interval
+	series          atomic.Int64 // series generated by all services
+	reconnects      atomic.Int64 // exporters recreated by -reconnect-after
+	resourceChanges atomic.Int64 // resources replaced by changing resource attributes
+	churned         atomic.Int64 // new resources of -resource-churn-rate
+	bytes           atomic.Int64 // OTLP protobuf size of -estimate-bandwidth exports
+	compressed      atomic.Int64 // gzip compressed size of -estimate-bandwidth exports
+	blocked         atomic.Int64 // exports that waited for a -max-inflight slot
+	busy            atomic.Int64 // exports skipped for lack of a -max-inflight slot
+	injected        atomic.Int64 // exports dropped by -chaos-probability and -chaos-every
+	flaps           atomic.Int64 // services gone down by -flap-fraction
+	services        atomic.Int64 // services currently running
+	failedServices  atomic.Int64 // services stopped by an error
+	duplicates      atomic.Int64 // data points repeated by -duplicate-points
+	malformed       atomic.Int64 // export requests stripped by -malformed-probability
+	overflowing     atomic.Int64 // services whose instruments hit -cardinality-limit
+	newSeries       atomic.Int64 // -new-series-per-interval series added since the last log
+	nans            atomic.Int64 // NaN recordings of histograms with a nanFraction
+	nanSums         atomic.Int64 // collected histogram data points with a NaN sum
+}
+
+// countDataPoints returns the number of data points in rm.
+func countDataPoints(rm *metricdata.ResourceMetrics) int {
+	n := 0
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			n += metricDataPoints(m)
+		}
+	}
+	return n
+}
+
+// exportSize returns the size of rm encoded as OTLP protobuf, as sent by the
+// exporters, and its size after gzip compression.
+func exportSize(rm *metricdata.ResourceMetrics) (size, compressed int, err error) {
+	pb, err := toMetricsData(rm)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := proto.Marshal(pb)
+	if err != nil {
+		return 0, 0, err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return 0, 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, 0, err
+	}
+	return len(b), buf.Len(), nil
+}
+
+// formatBytes formats a number of bytes with a binary unit prefix.
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 4 {
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGTP"[exp])
+}
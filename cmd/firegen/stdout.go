@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// stdoutMu serializes the writes of all stdout exporters, so the exports
+// of concurrent services do not interleave.
+var stdoutMu sync.Mutex
+
+// stdoutExporter prints every export to stdout as a line of OTLP JSON, the
+// format of -out-file, for -protocol stdout. The logs go to stderr, so
+// stdout only has the exports.
+type stdoutExporter struct {
+	w *jsonlWriter
+}
+
+func newStdoutExporter(rewrite *rewriter) *stdoutExporter {
+	return &stdoutExporter{w: &jsonlWriter{w: lockedWriter{os.Stdout}, rewrite: rewrite}}
+}
+
+func (e *stdoutExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *stdoutExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *stdoutExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.w.Write(rm)
+}
+
+func (e *stdoutExporter) ForceFlush(ctx context.Context) error {
+	return nil
+}
+
+// Shutdown leaves stdout open for the other services.
+func (e *stdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// lockedWriter writes to a file with stdoutMu held.
+type lockedWriter struct {
+	f *os.File
+}
+
+func (w lockedWriter) Write(b []byte) (int, error) {
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	return w.f.Write(b)
+}
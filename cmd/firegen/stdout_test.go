@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestStdoutExporter(t *testing.T) {
+	exporter, err := options{protocol: protocolStdout}.newExporter(context.Background())
+	require.NoError(t, err)
+	assert.IsType(t, &stdoutExporter{}, exporter)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	require.NoError(t, err)
+	defer f.Close()
+	// The exports of concurrent services are whole lines.
+	var wg sync.WaitGroup
+	for i := range 20 {
+		e := &stdoutExporter{w: &jsonlWriter{w: lockedWriter{f}}}
+		wg.Go(func() {
+			rm := &metricdata.ResourceMetrics{Resource: resource.NewSchemaless(attribute.String("service.name", fmt.Sprintf("service-%04d", i)))}
+			assert.NoError(t, e.Export(context.Background(), rm))
+		})
+	}
+	wg.Wait()
+	b, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+	require.Len(t, lines, 20)
+	for _, line := range lines {
+		var md metricspb.MetricsData
+		assert.NoError(t, protojson.Unmarshal(line, &md))
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// seriesClock is the event time elapsed since the start at a tick and the
+// series recorded on it, for the distributions that are functions of the
+// elapsed time.
+type seriesClock struct {
+	elapsed         time.Duration
+	service, series int
+}
+
+// nextValue returns the value recorded for a series on a tick. For gauges
+// this is the current value, for counters the increment since the last tick
+// and for histograms one of its observations.
+// A rate adds the event time elapsed since the last tick.
+// Patterns that depend on the previous value of the series read and update
+// it through state, which is nil for stateless patterns.
+func nextValue(rng *rand.Rand, opts metricOptions, elapsed time.Duration, state *float64) float64 {
+	if opts.Rate != nil {
+		return *opts.Rate * elapsed.Seconds()
+	}
+	if opts.Pattern == patternTimestamp {
+		return float64(time.Now().UnixMilli())
+	}
+	if opts.spread() {
+		return opts.bucketSample(rng)
+	}
+	lo, hi := opts.bounds()
+	if state != nil && opts.Pattern == patternRandomWalk {
+		step := opts.step()
+		*state = min(hi, max(lo, *state+(2*rng.Float64()-1)*step))
+		return *state
+	}
+	return lo + rng.Float64()*(hi-lo)
+}
+
+// sampler draws a value of a distribution for a series at a point in event
+// time. Random distributions ignore the time.
+type sampler func(rng *rand.Rand, at seriesClock) float64
+
+// samplers create the sampler of each distribution type from its
+// parameters.
+var samplers = map[string]func(d distributionConfig) sampler{
+	distributionNormal: func(d distributionConfig) sampler {
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			return d.Mean + rng.NormFloat64()*d.Stddev
+		}
+	},
+	distributionLognormal: func(d distributionConfig) sampler {
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			return math.Exp(d.Mu + rng.NormFloat64()*d.Sigma)
+		}
+	},
+	distributionExponential: func(d distributionConfig) sampler {
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			return rng.ExpFloat64() / d.Lambda
+		}
+	},
+	distributionPareto: func(d distributionConfig) sampler {
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			// Inverse transform sampling, 1-Float64 is in (0, 1].
+			return d.Scale / math.Pow(1-rng.Float64(), 1/d.Shape)
+		}
+	},
+	distributionUniform: func(d distributionConfig) sampler {
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			return d.Min + rng.Float64()*(d.Max-d.Min)
+		}
+	},
+	distributionSine: func(d distributionConfig) sampler {
+		period := d.Period.Seconds()
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			cycles := at.elapsed.Seconds()/period + d.phase(at)
+			return d.Offset + d.Amplitude*math.Sin(2*math.Pi*cycles)
+		}
+	},
+	distributionRamp: func(d distributionConfig) sampler {
+		reset := d.Reset.Seconds()
+		return func(rng *rand.Rand, at seriesClock) float64 {
+			seconds := at.elapsed.Seconds()
+			if reset > 0 {
+				seconds = math.Mod(seconds+d.phase(at)*reset, reset)
+				if seconds < 0 {
+					seconds += reset
+				}
+			}
+			return d.Offset + d.Slope*seconds
+		}
+	},
+}
+
+// sampler returns the sampler of the distribution, which must be valid.
+func (d distributionConfig) sampler() sampler {
+	return samplers[d.Type](d)
+}
+
+// phase returns the shift of a series in periods.
+func (d distributionConfig) phase(at seriesClock) float64 {
+	return d.Phase + float64(at.service)*d.ServicePhase + float64(at.series)*d.SeriesPhase
+}
+
+// bucketSample draws an observation from a random bucket, uniformly within
+// it. Bucket i holds values in (buckets[i-1], buckets[i]], the first bucket
+// gets its upper boundary and the last one values above the last boundary
+// within the width of the bucket before it.
+func (o metricOptions) bucketSample(rng *rand.Rand) float64 {
+	b := o.buckets()
+	switch i := rng.Intn(len(b) + 1); i {
+	case 0:
+		return b[0]
+	case len(b):
+		width := 1.0
+		if len(b) > 1 {
+			width = b[len(b)-1] - b[len(b)-2]
+		}
+		return b[len(b)-1] + (1-rng.Float64())*width
+	default:
+		return b[i-1] + (1-rng.Float64())*(b[i]-b[i-1])
+	}
+}
+
+// exprEnv is the environment value expressions are evaluated in.
+type exprEnv struct {
+	// T is the number of seconds since firegen started.
+	T float64 `expr:"t"`
+	// Service is the index of the service.
+	Service int `expr:"service"`
+	// Series is the index of the attribute combination of the series.
+	Series int `expr:"series"`
+
+	Sin     func(float64) float64          `expr:"sin"`
+	Cos     func(float64) float64          `expr:"cos"`
+	Exp     func(float64) float64          `expr:"exp"`
+	Log     func(float64) float64          `expr:"log"`
+	Sqrt    func(float64) float64          `expr:"sqrt"`
+	Pow     func(float64, float64) float64 `expr:"pow"`
+	Uniform func(float64, float64) float64 `expr:"uniform"`
+	Gauss   func(float64, float64) float64 `expr:"gauss"`
+}
+
+// newExprEnv returns an environment whose random functions draw from rng.
+func newExprEnv(rng *rand.Rand) exprEnv {
+	return exprEnv{
+		Sin:     math.Sin,
+		Cos:     math.Cos,
+		Exp:     math.Exp,
+		Log:     math.Log,
+		Sqrt:    math.Sqrt,
+		Pow:     math.Pow,
+		Uniform: func(lo, hi float64) float64 { return lo + rng.Float64()*(hi-lo) },
+		Gauss:   func(mean, stddev float64) float64 { return mean + rng.NormFloat64()*stddev },
+	}
+}
+
+// compileExpr compiles a value expression, which must evaluate to a number.
+func compileExpr(s string) (*vm.Program, error) {
+	return expr.Compile(s, expr.Env(exprEnv{}), expr.AsFloat64())
+}
+
+// evalExpr evaluates a compiled value expression in env.
+func evalExpr(program *vm.Program, env exprEnv) (float64, error) {
+	v, err := expr.Run(program, env)
+	if err != nil {
+		return 0, err
+	}
+	return v.(float64), nil
+}
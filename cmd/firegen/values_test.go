@@ -0,0 +1,187 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextValueRandomWalk(t *testing.T) {
+	lo, hi, step := 10.0, 20.0, 0.5
+	opts := metricOptions{Pattern: patternRandomWalk, Min: &lo, Max: &hi, Step: &step}
+	rng := rand.New(rand.NewSource(1))
+
+	state := 15.0
+	prev := state
+	for range 10000 {
+		v := nextValue(rng, opts, time.Second, &state)
+		assert.Equal(t, state, v)
+		assert.GreaterOrEqual(t, v, lo)
+		assert.LessOrEqual(t, v, hi)
+		assert.LessOrEqual(t, math.Abs(v-prev), step)
+		prev = v
+	}
+}
+
+func TestNextValueRandomRange(t *testing.T) {
+	lo, hi := -5.0, 5.0
+	opts := metricOptions{Min: &lo, Max: &hi}
+	rng := rand.New(rand.NewSource(1))
+	for range 1000 {
+		v := nextValue(rng, opts, time.Second, nil)
+		assert.GreaterOrEqual(t, v, lo)
+		assert.Less(t, v, hi)
+	}
+}
+
+func TestNextValueTimestamp(t *testing.T) {
+	opts := metricOptions{Pattern: patternTimestamp}
+	before := time.Now().UnixMilli()
+	v := nextValue(rand.New(rand.NewSource(1)), opts, time.Second, nil)
+	assert.GreaterOrEqual(t, v, float64(before))
+	assert.LessOrEqual(t, v, float64(time.Now().UnixMilli()))
+	assert.Equal(t, math.Trunc(v), v)
+
+	assert.NoError(t, opts.validate())
+	assert.Error(t, metricOptions{Type: metricCounter, Pattern: patternTimestamp}.validate())
+	assert.Error(t, metricOptions{Pattern: patternTimestamp, Expr: "t"}.validate())
+}
+
+func TestEvalExpr(t *testing.T) {
+	program, err := compileExpr("sin(t/60) * 50 + service * 10 + series")
+	assert.NoError(t, err)
+	env := newExprEnv(rand.New(rand.NewSource(1)))
+	env.T, env.Service, env.Series = 15*math.Pi, 2, 3
+	v, err := evalExpr(program, env)
+	assert.NoError(t, err)
+	assert.InDelta(t, math.Sin(math.Pi/4)*50+23, v, 1e-9)
+
+	program, err = compileExpr("gauss(100, 10)")
+	assert.NoError(t, err)
+	v, err = evalExpr(program, env)
+	assert.NoError(t, err)
+	assert.InDelta(t, 100, v, 100)
+
+	_, err = compileExpr("host + 1")
+	assert.Error(t, err)
+	_, err = compileExpr(`"text"`)
+	assert.Error(t, err)
+}
+
+func TestDistributionSample(t *testing.T) {
+	for _, test := range []struct {
+		distribution distributionConfig
+		mean         float64
+	}{
+		{distributionConfig{Type: distributionNormal, Mean: 100, Stddev: 10}, 100},
+		{distributionConfig{Type: distributionLognormal, Mu: 1, Sigma: 0.5}, math.Exp(1 + 0.5*0.5/2)},
+		{distributionConfig{Type: distributionExponential, Lambda: 4}, 0.25},
+		{distributionConfig{Type: distributionPareto, Scale: 2, Shape: 3}, 3},
+	} {
+		t.Run(test.distribution.Type, func(t *testing.T) {
+			assert.NoError(t, test.distribution.validate())
+			rng := rand.New(rand.NewSource(1))
+			sum := 0.0
+			n := 100000
+			for range n {
+				v := test.distribution.sampler()(rng, seriesClock{})
+				if test.distribution.Type == distributionPareto {
+					assert.GreaterOrEqual(t, v, test.distribution.Scale)
+				}
+				sum += v
+			}
+			assert.InEpsilon(t, test.mean, sum/float64(n), 0.02)
+		})
+	}
+	assert.Error(t, distributionConfig{Type: "poisson"}.validate())
+	assert.Error(t, distributionConfig{Type: distributionNormal}.validate())
+}
+
+func TestDistributionElapsed(t *testing.T) {
+	sine := distributionConfig{Type: distributionSine, Offset: 50, Amplitude: 10, Period: time.Minute, ServicePhase: 0.25, SeriesPhase: 0.5}
+	ramp := distributionConfig{Type: distributionRamp, Offset: 5, Slope: 2, Reset: 10 * time.Second, SeriesPhase: 0.5}
+	for _, test := range []struct {
+		distribution distributionConfig
+		at           seriesClock
+		want         float64
+	}{
+		{sine, seriesClock{0, 0, 0}, 50},
+		{sine, seriesClock{15 * time.Second, 0, 0}, 60},
+		{sine, seriesClock{30 * time.Second, 0, 0}, 50},
+		{sine, seriesClock{45 * time.Second, 0, 0}, 40},
+		{sine, seriesClock{time.Minute + 15*time.Second, 0, 0}, 60},
+		// Every service is a quarter and every series half a period ahead.
+		{sine, seriesClock{0, 1, 0}, 60},
+		{sine, seriesClock{15 * time.Second, 0, 1}, 40},
+		{sine, seriesClock{15 * time.Second, 1, 1}, 50},
+		{ramp, seriesClock{0, 0, 0}, 5},
+		{ramp, seriesClock{4 * time.Second, 0, 0}, 13},
+		{ramp, seriesClock{10 * time.Second, 0, 0}, 5},
+		{ramp, seriesClock{12 * time.Second, 0, 0}, 9},
+		{ramp, seriesClock{0, 0, 1}, 15},
+		{ramp, seriesClock{6 * time.Second, 0, 1}, 7},
+		{ramp, seriesClock{0, 0, -1}, 15},
+		{distributionConfig{Type: distributionRamp, Slope: 0.5}, seriesClock{time.Hour, 3, 3}, 1800},
+	} {
+		assert.NoError(t, test.distribution.validate())
+		// The values do not depend on the random generator.
+		v := test.distribution.sampler()(rand.New(rand.NewSource(int64(test.at.series))), test.at)
+		assert.InDelta(t, test.want, v, 1e-9, "%s at %+v", test.distribution.Type, test.at)
+	}
+
+	uniform := distributionConfig{Type: distributionUniform, Min: 10, Max: 20}
+	assert.NoError(t, uniform.validate())
+	rng := rand.New(rand.NewSource(1))
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for range 10000 {
+		v := uniform.sampler()(rng, seriesClock{})
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	assert.GreaterOrEqual(t, lo, 10.0)
+	assert.Less(t, lo, 10.1)
+	assert.Less(t, hi, 20.0)
+	assert.Greater(t, hi, 19.9)
+
+	assert.Error(t, distributionConfig{Type: distributionUniform, Min: 1, Max: 1}.validate())
+	assert.Error(t, distributionConfig{Type: distributionSine, Amplitude: 1}.validate())
+	assert.Error(t, distributionConfig{Type: distributionRamp, Reset: -time.Second}.validate())
+	assert.True(t, distributionConfig{Type: distributionSine, Offset: 5, Amplitude: 10, Period: time.Second}.negative())
+	assert.False(t, distributionConfig{Type: distributionSine, Offset: 10, Amplitude: 10, Period: time.Second}.negative())
+	assert.True(t, distributionConfig{Type: distributionRamp, Slope: -1}.negative())
+}
+
+func TestBucketSample(t *testing.T) {
+	opts := metricOptions{Type: metricHistogram, Buckets: []float64{1, 5, 10}}
+	assert.True(t, opts.spread())
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, 4)
+	for range 10000 {
+		v := nextValue(rng, opts, time.Second, nil)
+		// Bucket i holds the values in (buckets[i-1], buckets[i]].
+		switch {
+		case v <= 1:
+			assert.Equal(t, 1.0, v)
+			counts[0]++
+		case v <= 5:
+			counts[1]++
+		case v <= 10:
+			counts[2]++
+		default:
+			assert.LessOrEqual(t, v, 15.0)
+			counts[3]++
+		}
+	}
+	for i, n := range counts {
+		assert.InDelta(t, 2500, n, 200, "bucket %d", i)
+	}
+
+	lo, hi := 2.0, 3.0
+	assert.False(t, metricOptions{Type: metricHistogram, Min: &lo, Max: &hi}.spread())
+	assert.False(t, metricOptions{Type: metricGauge}.spread())
+	assert.Equal(t, 1, metricOptions{}.observations())
+	assert.Equal(t, defaultObservations, opts.observations())
+	assert.Equal(t, 3, metricOptions{Type: metricHistogram, Observations: 3}.observations())
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"cmp"
+	"runtime/debug"
+)
+
+// Build metadata embedded with
+//
+//	go build -ldflags "-X main.buildVersion=v1.2.3 -X main.buildCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+//
+// Unset values fall back to the build info of the binary.
+var (
+	buildVersion string
+	buildCommit  string
+	buildDate    string
+)
+
+// version returns the version firegen was built as, the module version
+// without -ldflags and "(devel)" for builds from a source checkout.
+func version() string {
+	if buildVersion != "" {
+		return buildVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// buildInfo returns the git commit and date of the build, from -ldflags or
+// the VCS information Go stamps into binaries built in a git checkout.
+func buildInfo() (commit, date string) {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				commit = setting.Value
+			case "vcs.time":
+				date = setting.Value
+			}
+		}
+	}
+	return cmp.Or(buildCommit, commit, "unknown"), cmp.Or(buildDate, date, "unknown")
+}